@@ -1,5 +1,24 @@
 package main
 
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"server/internal/app"
+	"server/internal/config"
+	"syscall"
+)
+
 func main() {
+	cfg, err := config.New()
+	if err != nil {
+		slog.Error("loading config", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
+	app.Run(ctx, cfg)
 }
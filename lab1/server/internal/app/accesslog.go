@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// accessSampler counts successful requests per method so that one in
+// every N can be logged. Counting rather than rolling dice keeps the
+// logged fraction exact.
+type accessSampler struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// next returns how many successful requests to method came before this one.
+func (a *accessSampler) next(method string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.counts == nil {
+		a.counts = make(map[string]uint64)
+	}
+	n := a.counts[method]
+	a.counts[method]++
+
+	return n
+}
+
+// logSampleRate is N in "log 1 in N successful requests" for method.
+func (s *Service) logSampleRate(method string) int {
+	if rate, ok := s.cfg.LogSampleRates[method]; ok {
+		return rate
+	}
+
+	return s.cfg.LogSampleRate
+}
+
+// logAccess writes the access log line for a handled request. Failures
+// are always logged; successes are sampled, and those sampled out are
+// still logged at debug level.
+func (s *Service) logAccess(req *RPCRequest, addr net.Addr, status string) {
+	level := slog.LevelInfo
+	if status == "OK" {
+		rate := s.logSampleRate(req.Method)
+		if rate > 1 && s.sampler.next(req.Method)%uint64(rate) != 0 {
+			level = slog.LevelDebug
+		}
+	}
+
+	s.logger.Log(context.Background(), level, "request",
+		"method", req.Method,
+		"request_id", req.RequestID,
+		"source", addrString(addr),
+		"status", status,
+	)
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+)
+
+// adminMethods need the configured AdminToken in params["token"]. They
+// are disabled when no token is configured, and their params are never
+// written to the audit log.
+var adminMethods = map[string]bool{
+	"drain":         true,
+	"reset_cache":   true,
+	"log_snapshot":  true,
+	"tail_logs":     true,
+	"unsubscribe":   true,
+	"set_log_level": true,
+}
+
+func (s *Service) requireAdmin(params map[string]interface{}) error {
+	token, _ := params["token"].(string)
+
+	if s.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+		return &MethodError{Message: "admin token required", Status: "UNAUTHORIZED"}
+	}
+
+	return nil
+}
+
+// resetCache forgets every remembered RequestID, so a request that was
+// answered DUPLICATE before runs again. It returns how many were cleared.
+func (s *Service) resetCache(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"cleared": s.requestLog.Reset()}, nil
+}
+
+// setLogLevel changes the server's log level until the next restart, e.g.
+// to "debug" while looking into an incident. It returns the old and new
+// levels.
+func (s *Service) setLogLevel(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	name, ok := params["level"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'level' must be a string")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return nil, fmt.Errorf("parameter 'level' must be debug, info, warn or error")
+	}
+
+	previous := s.logLevel.Level()
+	s.logLevel.Set(level)
+	s.logger.Warn("log level changed", "from", previous, "to", level)
+
+	return map[string]interface{}{"previous": previous.String(), "level": level.String()}, nil
+}
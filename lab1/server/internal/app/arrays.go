@@ -0,0 +1,139 @@
+package app
+
+import "fmt"
+
+// zipArrays pairs up the i-th elements of each array in arrays, which
+// must all have the same length.
+func (s *Service) zipArrays(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	arrays, err := getEqualArrays(params, "arrays")
+	if err != nil {
+		return nil, err
+	}
+	if len(arrays) == 0 {
+		return nil, fmt.Errorf("parameter 'arrays' must not be empty")
+	}
+
+	return transpose(arrays, len(arrays[0])), nil
+}
+
+// unzipArrays is the inverse of zipArrays: it splits equal-length tuples
+// back into one array per position.
+func (s *Service) unzipArrays(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	tuples, err := getEqualArrays(params, "tuples")
+	if err != nil {
+		return nil, err
+	}
+	if len(tuples) == 0 {
+		return []interface{}{}, nil
+	}
+
+	return transpose(tuples, len(tuples[0])), nil
+}
+
+// getEqualArrays reads an array of arrays that all have the same length.
+func getEqualArrays(params map[string]interface{}, name string) ([][]interface{}, error) {
+	raw, ok := params[name].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter '%s' must be an array of arrays", name)
+	}
+
+	arrays := make([][]interface{}, len(raw))
+	for i, elem := range raw {
+		array, ok := elem.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' element %d must be an array", name, i)
+		}
+		if i > 0 && len(array) != len(arrays[0]) {
+			return nil, fmt.Errorf("parameter '%s' element %d has length %d, expected %d", name, i, len(array), len(arrays[0]))
+		}
+		arrays[i] = array
+	}
+
+	return arrays, nil
+}
+
+// transpose turns rows of the given width into width columns.
+func transpose(rows [][]interface{}, width int) []interface{} {
+	columns := make([]interface{}, width)
+	for j := range columns {
+		column := make([]interface{}, len(rows))
+		for i, row := range rows {
+			column[i] = row[j]
+		}
+		columns[j] = column
+	}
+
+	return columns
+}
+
+// flatten removes one level of nesting from values, or every level with
+// deep set. Elements must be numbers, strings or arrays of them.
+func (s *Service) flatten(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, ok := params["values"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'values' must be an array")
+	}
+
+	deep, err := getOptionalBool(params, "deep", false)
+	if err != nil {
+		return nil, err
+	}
+
+	depth := 1
+	if deep {
+		depth = -1
+	}
+
+	return flattenInto(make([]interface{}, 0, len(values)), values, depth)
+}
+
+// flattenInto appends values to out, expanding nested arrays down to depth
+// levels; a negative depth expands all of them.
+func flattenInto(out, values []interface{}, depth int) ([]interface{}, error) {
+	for _, v := range values {
+		switch v := v.(type) {
+		case float64, string:
+			out = append(out, v)
+		case []interface{}:
+			if depth == 0 {
+				out = append(out, v)
+				continue
+			}
+
+			var err error
+			if out, err = flattenInto(out, v, depth-1); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("parameter 'values' must hold only numbers, strings and arrays")
+		}
+	}
+
+	return out, nil
+}
+
+// chunk splits values into arrays of size elements; the last one holds
+// whatever is left over.
+func (s *Service) chunk(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, ok := params["values"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'values' must be an array")
+	}
+
+	size, err := getInt(params, "size")
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("parameter 'size' must be at least 1")
+	}
+
+	chunks := make([]interface{}, 0, (int64(len(values))+size-1)/size)
+	for len(values) > 0 {
+		n := int(min(size, int64(len(values))))
+		chunks = append(chunks, values[:n])
+		values = values[n:]
+	}
+
+	return chunks, nil
+}
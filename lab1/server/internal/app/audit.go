@@ -0,0 +1,117 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditLog appends one JSON line per request to a file. Entries are
+// queued and written by a background goroutine so request handling
+// never waits on disk I/O unless the queue is full.
+type auditLog struct {
+	file    *os.File
+	redact  map[string]bool
+	logger  *slog.Logger
+	entries chan auditEntry
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type auditEntry struct {
+	RequestID string                 `json:"request_id"`
+	Method    string                 `json:"method"`
+	Source    string                 `json:"source"`
+	Status    string                 `json:"status"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Redacted  bool                   `json:"redacted,omitempty"`
+	Timestamp int64                  `json:"timestamp"`
+}
+
+func newAuditLog(path string, redactMethods []string, logger *slog.Logger) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	redact := make(map[string]bool, len(redactMethods))
+	for _, method := range redactMethods {
+		redact[method] = true
+	}
+
+	a := &auditLog{
+		file:    file,
+		redact:  redact,
+		logger:  logger,
+		entries: make(chan auditEntry, 1024),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+
+	return a, nil
+}
+
+// Record queues an entry for req. It is a no-op on a nil or closed log.
+func (a *auditLog) Record(req *RPCRequest, addr net.Addr, status string) {
+	if a == nil {
+		return
+	}
+
+	entry := auditEntry{
+		RequestID: req.RequestID,
+		Method:    req.Method,
+		Source:    addrString(addr),
+		Status:    status,
+		Params:    req.Params,
+		Timestamp: time.Now().Unix(),
+	}
+
+	if a.redact[req.Method] || adminMethods[req.Method] {
+		entry.Params = nil
+		entry.Redacted = true
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return
+	}
+	a.entries <- entry
+}
+
+// Close flushes queued entries and closes the file.
+func (a *auditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.entries)
+	a.mu.Unlock()
+
+	<-a.done
+
+	return a.file.Close()
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+
+	encoder := json.NewEncoder(a.file)
+	for entry := range a.entries {
+		if err := encoder.Encode(entry); err != nil {
+			a.logger.Error("writing audit entry", "error", err)
+		}
+	}
+}
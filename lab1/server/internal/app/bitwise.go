@@ -0,0 +1,84 @@
+package app
+
+import "fmt"
+
+// maxShift keeps shifts inside an int64.
+const maxShift = 63
+
+func (s *Service) bitAnd(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := getIntPair(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a & b, nil
+}
+
+func (s *Service) bitOr(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := getIntPair(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a | b, nil
+}
+
+func (s *Service) bitXor(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := getIntPair(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a ^ b, nil
+}
+
+func (s *Service) shiftLeft(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, bits, err := getShiftParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a << bits, nil
+}
+
+// shiftRight is an arithmetic shift, so negative values keep their sign.
+func (s *Service) shiftRight(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, bits, err := getShiftParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a >> bits, nil
+}
+
+func getIntPair(params map[string]interface{}) (int64, int64, error) {
+	a, err := getInt(params, "a")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	b, err := getInt(params, "b")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return a, b, nil
+}
+
+func getShiftParams(params map[string]interface{}) (int64, uint, error) {
+	a, err := getInt(params, "a")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bits, err := getInt(params, "bits")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if bits < 0 || bits > maxShift {
+		return 0, 0, fmt.Errorf("parameter 'bits' must be between 0 and %d", maxShift)
+	}
+
+	return a, uint(bits), nil
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"net"
+)
+
+// CallContext carries per-request information into a method. The
+// embedded Context holds the method's deadline and is cancelled when its
+// timeout expires, so long-running methods should check it.
+type CallContext struct {
+	context.Context
+
+	RequestID string
+	TraceID   string
+	Source    net.Addr
+}
+
+func newCallContext(req *RPCRequest, addr net.Addr) *CallContext {
+	traceID := req.TraceID
+	if traceID == "" {
+		traceID = req.RequestID
+	}
+
+	return &CallContext{
+		Context:   context.Background(),
+		RequestID: req.RequestID,
+		TraceID:   traceID,
+		Source:    addr,
+	}
+}
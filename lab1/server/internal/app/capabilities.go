@@ -0,0 +1,72 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+// Client settings the capabilities method advertises unless overridden
+// in the config. They match the README's recommended client defaults.
+const (
+	defaultClientTimeout    = 2 * time.Second
+	defaultClientMaxRetries = 2
+	defaultBackoff          = 500 * time.Millisecond
+)
+
+// capabilities tells clients the timeout, retry count and backoff step
+// the server is tuned for. RPCClient.AdoptCapabilities applies them.
+func (s *Service) capabilities(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	timeout := s.cfg.ClientTimeout
+	if timeout <= 0 {
+		timeout = defaultClientTimeout
+	}
+
+	// An explicit 0 means no retries, so only an unset value gets the
+	// default. A negative count is treated as 0.
+	maxRetries := defaultClientMaxRetries
+	if s.cfg.ClientMaxRetries != nil {
+		maxRetries = max(*s.cfg.ClientMaxRetries, 0)
+	}
+
+	backoff := s.cfg.ClientBackoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	return map[string]interface{}{
+		"timeout_ms":  timeout.Milliseconds(),
+		"max_retries": maxRetries,
+		"backoff_ms":  backoff.Milliseconds(),
+	}, nil
+}
+
+// AdoptCapabilities asks the server for its recommended client settings
+// and sets Timeout, MaxRetries and Backoff to them. The call itself uses
+// the client's current settings.
+func (c *RPCClient) AdoptCapabilities() error {
+	resp, err := c.Call("capabilities", nil)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "OK" {
+		return fmt.Errorf("capabilities failed: %s", resp.Error)
+	}
+
+	caps, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("capabilities returned %T, expected an object", resp.Result)
+	}
+
+	timeoutMs, ok1 := caps["timeout_ms"].(float64)
+	maxRetries, ok2 := caps["max_retries"].(float64)
+	backoffMs, ok3 := caps["backoff_ms"].(float64)
+	if !ok1 || !ok2 || !ok3 || timeoutMs <= 0 || maxRetries < 0 || backoffMs <= 0 {
+		return fmt.Errorf("capabilities returned invalid settings: %v", caps)
+	}
+
+	c.Timeout = time.Duration(timeoutMs) * time.Millisecond
+	c.MaxRetries = int(maxRetries)
+	c.Backoff = time.Duration(backoffMs) * time.Millisecond
+
+	return nil
+}
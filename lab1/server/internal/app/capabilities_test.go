@@ -0,0 +1,80 @@
+package app
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+func TestAdoptCapabilities(t *testing.T) {
+	retries := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		timeout time.Duration
+		retries int
+		backoff time.Duration
+	}{
+		{"defaults", config.Config{}, 2 * time.Second, 2, 500 * time.Millisecond},
+		{
+			name:    "configured",
+			cfg:     config.Config{ClientTimeout: 5 * time.Second, ClientMaxRetries: retries(4), ClientBackoff: 100 * time.Millisecond},
+			timeout: 5 * time.Second,
+			retries: 4,
+			backoff: 100 * time.Millisecond,
+		},
+		{"no retries", config.Config{ClientMaxRetries: retries(0)}, 2 * time.Second, 0, 500 * time.Millisecond},
+		{"negative retries", config.Config{ClientMaxRetries: retries(-1)}, 2 * time.Second, 0, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, &tt.cfg)
+
+			client := ts.client(t)
+			client.MaxRetries = 7
+			if err := client.AdoptCapabilities(); err != nil {
+				t.Fatal(err)
+			}
+
+			if client.Timeout != tt.timeout || client.MaxRetries != tt.retries || client.Backoff != tt.backoff {
+				t.Errorf("adopted timeout %v, %d retries, backoff %v; want %v, %d, %v",
+					client.Timeout, client.MaxRetries, client.Backoff, tt.timeout, tt.retries, tt.backoff)
+			}
+		})
+	}
+}
+
+func TestAdoptCapabilitiesInvalid(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	tests := []struct {
+		name   string
+		result interface{}
+	}{
+		{"not an object", []interface{}{1.0}},
+		{"missing field", map[string]interface{}{"timeout_ms": 100.0, "backoff_ms": 10.0}},
+		{"zero timeout", map[string]interface{}{"timeout_ms": 0.0, "max_retries": 1.0, "backoff_ms": 10.0}},
+		{"negative retries", map[string]interface{}{"timeout_ms": 100.0, "max_retries": -1.0, "backoff_ms": 10.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+				return []*RPCResponse{{RequestID: req.RequestID, Status: "OK", Result: tt.result}}
+			})
+
+			client := ts.clientFor(t, server.conn.Addr(), time.Second, 3)
+			err := client.AdoptCapabilities()
+			if err == nil || !strings.Contains(err.Error(), "capabilities returned") {
+				t.Fatalf("got %v, want the settings rejected", err)
+			}
+			if client.Timeout != time.Second || client.MaxRetries != 3 {
+				t.Errorf("client changed to %v and %d retries", client.Timeout, client.MaxRetries)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// challengeTTL is how long a nonce may be echoed back.
+const challengeTTL = 30 * time.Second
+
+// challenger guards methods with a return-path check. A request to a
+// guarded method is answered CHALLENGE with a nonce, and only a request
+// echoing that nonce from the same address runs. A spoofed source never
+// sees the nonce.
+//
+// Nonces are an HMAC over the address, method and issue time under a
+// per-process key, so the server keeps no state per challenge and a
+// flood of spoofed requests cannot fill its memory.
+type challenger struct {
+	key     []byte
+	methods map[string]bool
+	now     func() time.Time
+}
+
+// newChallenger returns nil when no methods are guarded.
+func newChallenger(methods []string) *challenger {
+	if len(methods) == 0 {
+		return nil
+	}
+
+	c := &challenger{
+		key:     make([]byte, 32),
+		methods: make(map[string]bool, len(methods)),
+		now:     time.Now,
+	}
+	rand.Read(c.key)
+	for _, method := range methods {
+		c.methods[method] = true
+	}
+
+	return c
+}
+
+func (c *challenger) required(method string) bool {
+	return c != nil && c.methods[method]
+}
+
+// issue returns a nonce for method from addr, formatted as
+// "<unix time>.<hex mac>".
+func (c *challenger) issue(method string, addr net.Addr) string {
+	issued := strconv.FormatInt(c.now().Unix(), 10)
+
+	return issued + "." + c.mac(method, addr, issued)
+}
+
+// verify reports whether nonce was issued for method and addr and has not
+// expired.
+func (c *challenger) verify(nonce, method string, addr net.Addr) bool {
+	issued, mac, ok := strings.Cut(nonce, ".")
+	if !ok {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := c.now().Sub(time.Unix(unix, 0))
+	if age < 0 || age > challengeTTL {
+		return false
+	}
+
+	return hmac.Equal([]byte(mac), []byte(c.mac(method, addr, issued)))
+}
+
+func (c *challenger) mac(method string, addr net.Addr, issued string) string {
+	h := hmac.New(sha256.New, c.key)
+	h.Write([]byte(addrString(addr) + "\x00" + method + "\x00" + issued))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
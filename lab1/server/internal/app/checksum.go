@@ -0,0 +1,57 @@
+package app
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+var checksumAlgos = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksum digests base64-encoded binary data and returns the digest as
+// lowercase hex.
+func (s *Service) checksum(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	encoded, ok := params["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'data' must be a base64 string")
+	}
+
+	algo, ok := params["algo"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'algo' must be a string")
+	}
+
+	newHash, ok := checksumAlgos[strings.ToLower(algo)]
+	if !ok {
+		names := make([]string, 0, len(checksumAlgos))
+		for name := range checksumAlgos {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown algo %q, expected one of %s", algo, strings.Join(names, ", "))
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'data' is not valid base64: %v", err)
+	}
+
+	h := newHash()
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
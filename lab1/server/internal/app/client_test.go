@@ -0,0 +1,374 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPipelinedCalls(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client := ts.client(t)
+
+	ids := make([]string, 5)
+	for i := range ids {
+		id, err := client.Send("add", params{"a": i, "b": 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+
+	// Collect in reverse to show responses are buffered per request.
+	for i := len(ids) - 1; i >= 0; i-- {
+		resp, err := client.Collect(ids[i], time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Result != float64(i+100) {
+			t.Errorf("request %d: result %v, want %d", i, resp.Result, i+100)
+		}
+	}
+
+	if _, err := client.Collect("unknown", time.Millisecond); err == nil {
+		t.Error("Collect of an unknown id succeeded")
+	}
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	// The in-memory transport carries datagrams of any size, unlike UDP.
+	huge := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+		return []*RPCResponse{{RequestID: req.RequestID, Status: "OK", Result: strings.Repeat("x", defaultBufferSize)}}
+	})
+
+	tests := []struct {
+		name       string
+		server     net.Addr
+		bufferSize int
+		want       string
+	}{
+		{"over the client's buffer", ts.conn.Addr(), 64, "buffer size is 64"},
+		{"over the largest datagram", huge.conn.Addr(), 0, fmt.Sprintf("more than %d bytes", defaultBufferSize)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := ts.clientFor(t, tt.server, time.Second, 0)
+			client.BufferSize = tt.bufferSize
+
+			_, err := client.Call("echo", params{"s": strings.Repeat("x", 200)})
+			if err == nil || !strings.Contains(err.Error(), "response truncated") || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want a truncation error mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	// A response that fits is read whole.
+	client := ts.client(t)
+	client.BufferSize = 1024
+	if resp, err := client.Call("echo", params{"s": "x"}); err != nil || resp.Status != "OK" {
+		t.Errorf("small response: %v %v", resp, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	ts := newTestServer(t, nil)
+	silent := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse { return nil })
+
+	tests := []struct {
+		name     string
+		call     func(c *RPCClient) (*RPCResponse, error)
+		attempts int
+	}{
+		{"call retries", func(c *RPCClient) (*RPCResponse, error) { return c.Call("add", nil) }, 3},
+		{"call once", func(c *RPCClient) (*RPCResponse, error) { return c.CallOnce("add", nil) }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(silent.received())
+
+			client := ts.clientFor(t, silent.conn.Addr(), 10*time.Millisecond, 2)
+			if _, err := tt.call(client); err == nil {
+				t.Fatal("call to a silent server succeeded")
+			}
+
+			// Give the last datagram time to arrive.
+			time.Sleep(10 * time.Millisecond)
+			if got := len(silent.received()) - before; got != tt.attempts {
+				t.Errorf("sent %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	ts := newTestServer(t, nil)
+	silent := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse { return nil })
+
+	budget := NewRetryBudget(1, 0)
+
+	first := ts.clientFor(t, silent.conn.Addr(), 5*time.Millisecond, 3)
+	first.RetryBudget = budget
+	_, err := first.Call("add", nil)
+	if err == nil || !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Fatalf("first call: %v, want the budget to run out", err)
+	}
+
+	// The budget is shared, so a second client gets no retries at all.
+	second := ts.clientFor(t, silent.conn.Addr(), 5*time.Millisecond, 3)
+	second.RetryBudget = budget
+	before := len(silent.received())
+	second.Call("add", nil)
+	time.Sleep(10 * time.Millisecond)
+
+	if got := len(silent.received()) - before; got != 1 {
+		t.Errorf("second client sent %d attempts, want 1", got)
+	}
+}
+
+func TestCallTimeoutsDoNotLeak(t *testing.T) {
+	ts := newTestServer(t, nil)
+	silent := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse { return nil })
+
+	cc := NewClientConn(ts.listen(t))
+	t.Cleanup(func() { cc.Close() })
+	client := cc.NewClientAddr(silent.conn.Addr(), 2*time.Millisecond, 0)
+
+	// The first call starts the conn's read loop, which is meant to stay.
+	client.Call("add", nil)
+	before := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := client.Call("add", nil); err == nil {
+					t.Error("call to a silent server succeeded")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Exiting goroutines may take a moment to be counted out.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines after 200 timed out calls, %d before", after, before)
+	}
+
+	cc.mu.Lock()
+	pending := len(cc.pending)
+	cc.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("%d calls still registered", pending)
+	}
+}
+
+func TestIDGen(t *testing.T) {
+	ts := newTestServer(t, nil)
+	echo := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+		return []*RPCResponse{{RequestID: req.RequestID, Status: "OK"}}
+	})
+
+	client := ts.clientFor(t, echo.conn.Addr(), time.Second, 0)
+	n := 0
+	client.IDGen = func() string {
+		n++
+		return fmt.Sprintf("test-%d", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("health", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := echo.received()
+	if len(received) != 2 || received[0].RequestID != "test-1" || received[1].RequestID != "test-2" {
+		t.Errorf("request ids %+v, want test-1 and test-2", received)
+	}
+}
+
+func TestCallInto(t *testing.T) {
+	ts := newTestServer(t, nil)
+	client := ts.client(t)
+
+	var stats struct {
+		Words     int     `json:"words"`
+		AvgLength float64 `json:"avg_word_length"`
+	}
+	if err := client.CallInto("text_stats", params{"s": "ab cdef"}, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Words != 2 || stats.AvgLength != 3 {
+		t.Errorf("decoded %+v", stats)
+	}
+
+	var sum float64
+	err := client.CallInto("divide", params{"a": 1, "b": 0}, &sum)
+	if err == nil || !strings.Contains(err.Error(), "status ERROR") {
+		t.Errorf("failed call decoded with %v", err)
+	}
+}
+
+func TestSharedClientConn(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	cc := NewClientConn(ts.listen(t))
+	t.Cleanup(func() { cc.Close() })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		client := cc.NewClientAddr(ts.conn.Addr(), time.Second, 0)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Call("multiply", params{"a": i, "b": 2})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.Result != float64(2*i) {
+				t.Errorf("client %d got %v, want %d", i, resp.Result, 2*i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Closing the conn fails calls on it right away.
+	cc.Close()
+	client := cc.NewClientAddr(ts.conn.Addr(), time.Second, 0)
+	if _, err := client.Call("health", nil); err == nil {
+		t.Error("call on a closed conn succeeded")
+	}
+}
+
+func TestDuplicateAnswerSkipped(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	// An answer to a retry can be DUPLICATE while the real response to
+	// the first attempt is still on its way.
+	server := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+		return []*RPCResponse{
+			{RequestID: req.RequestID, Status: "DUPLICATE"},
+			{RequestID: req.RequestID, Status: "OK", Result: 3.0},
+		}
+	})
+
+	client := ts.clientFor(t, server.conn.Addr(), time.Second, 0)
+	resp, err := client.Call("add", params{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "OK" || resp.Result != 3.0 {
+		t.Errorf("got %s %v, want the OK answer", resp.Status, resp.Result)
+	}
+}
+
+func TestLostResponseAnsweredDuplicate(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	// The first response is lost on its way back; the server has run
+	// the request, so the retry is answered DUPLICATE.
+	var attempts atomic.Int64
+	server := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+		if attempts.Add(1) == 1 {
+			return nil
+		}
+		return []*RPCResponse{{RequestID: req.RequestID, Status: "DUPLICATE", Error: "request already processed"}}
+	})
+
+	client := ts.clientFor(t, server.conn.Addr(), 20*time.Millisecond, 5)
+	resp, err := client.Call("add", params{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatalf("got %v, want the DUPLICATE answer", err)
+	}
+	if resp.Status != "DUPLICATE" {
+		t.Errorf("status %s, want DUPLICATE", resp.Status)
+	}
+
+	// Further retries would only be answered DUPLICATE again.
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("sent %d attempts, want 2", got)
+	}
+}
+
+func TestCallCoalesced(t *testing.T) {
+	const callers = 5
+
+	ts := newTestServer(t, nil)
+
+	// The server holds its answer until every caller has joined the call.
+	release := make(chan struct{})
+	slow := newFakeServer(t, ts, func(req *RPCRequest) []*RPCResponse {
+		<-release
+		return []*RPCResponse{{RequestID: req.RequestID, Status: "OK", Result: 1.0}}
+	})
+
+	client := ts.clientFor(t, slow.conn.Addr(), 5*time.Second, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.CallCoalesced("", "get_time", nil)
+			if err != nil || resp.Result != 1.0 {
+				t.Errorf("got %v, %v", resp, err)
+			}
+		}()
+	}
+
+	// A caller counts as a hit once it has found the call in flight.
+	for start := time.Now(); client.CoalesceStats().Hits < callers-1; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			close(release)
+			t.Fatalf("only %d callers joined the call", client.CoalesceStats().Hits)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if got := len(slow.received()); got != 1 {
+		t.Errorf("server received %d requests, want 1", got)
+	}
+
+	want := CoalesceStats{Hits: callers - 1, Misses: 1, SavedSends: callers - 1}
+	if stats := client.CoalesceStats(); stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+// shortWriter accepts only part of each datagram.
+type shortWriter struct {
+	Transport
+}
+
+func (w shortWriter) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return len(p) / 2, nil
+}
+
+func TestShortWrite(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	err := writePacket(shortWriter{ts.listen(t)}, []byte("0123456789"), ts.conn.Addr())
+	if err == nil || !strings.Contains(err.Error(), "short write") {
+		t.Errorf("got %v, want a short write error", err)
+	}
+}
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultBufferSize holds the largest UDP payload, so any response the
+// server can send arrives whole. Requests are capped much lower, at
+// readBufferSize, and chunked above it, but their responses are not: the
+// result of a chunked sort or echo is as large as the request. It is also
+// the most an RPCClient's BufferSize can raise the limit to.
+const defaultBufferSize = 64 << 10
+
+// ClientConn is the socket behind one or more RPCClients. A single
+// read loop routes each response to the caller waiting on its RequestID,
+// so many logical clients can share one local port.
+//
+// Sharing trades isolation for ports: every client on the conn shares its
+// receive buffer and read loop, so one client flooding the socket can
+// delay responses for the others, and closing the conn breaks them all.
+// Binding a fixed local port also means only one process can use it.
+type ClientConn struct {
+	Conn Transport
+
+	// localPath is the bound socket file of a Unix datagram conn.
+	localPath string
+
+	mu        sync.Mutex
+	pending   map[string]*pendingCall
+	streams   map[string]*streamAssembly
+	closed    bool
+	startRead sync.Once
+}
+
+type rpcResult struct {
+	resp *RPCResponse
+	err  error
+}
+
+// pendingCall is a caller waiting for the response to one RequestID.
+type pendingCall struct {
+	result     chan rpcResult
+	bufferSize int
+}
+
+// ListenClientConn binds a client socket on localPort, or on an ephemeral
+// port when localPort is 0.
+func ListenClientConn(localPort int) (*ClientConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: localPort})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClientConn(conn), nil
+}
+
+// ListenUnixClientConn binds a Unix datagram client socket at localPath.
+// The server replies to this path, so it must be unique per conn.
+func ListenUnixClientConn(localPath string) (*ClientConn, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: localPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	cc := NewClientConn(conn)
+	cc.localPath = localPath
+
+	return cc, nil
+}
+
+// NewClientConn wraps an already bound transport.
+func NewClientConn(conn Transport) *ClientConn {
+	return &ClientConn{
+		Conn:    conn,
+		pending: make(map[string]*pendingCall),
+		streams: make(map[string]*streamAssembly),
+	}
+}
+
+// NewClient creates a logical client that sends through this conn.
+func (cc *ClientConn) NewClient(serverHost string, serverPort int, timeout time.Duration, maxRetries int) (*RPCClient, error) {
+	serverAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", serverHost, serverPort))
+	if err != nil {
+		return nil, err
+	}
+
+	return cc.NewClientAddr(serverAddr, timeout, maxRetries), nil
+}
+
+// NewUnixClient creates a logical client for a server listening on the
+// Unix datagram socket at socketPath.
+func (cc *ClientConn) NewUnixClient(socketPath string, timeout time.Duration, maxRetries int) *RPCClient {
+	serverAddr := &net.UnixAddr{Name: socketPath, Net: "unixgram"}
+
+	return cc.NewClientAddr(serverAddr, timeout, maxRetries)
+}
+
+// NewClientAddr creates a logical client for the server at serverAddr.
+func (cc *ClientConn) NewClientAddr(serverAddr net.Addr, timeout time.Duration, maxRetries int) *RPCClient {
+	return &RPCClient{
+		ServerAddr: serverAddr,
+		Conn:       cc.Conn,
+		Timeout:    timeout,
+		MaxRetries: maxRetries,
+		mux:        cc,
+	}
+}
+
+// Close closes the socket, which stops the read loop for every client.
+func (cc *ClientConn) Close() error {
+	err := cc.Conn.Close()
+
+	if cc.localPath != "" {
+		os.Remove(cc.localPath)
+	}
+
+	return err
+}
+
+// register starts waiting for the response to requestID. A response
+// larger than bufferSize bytes fails the call as truncated.
+func (cc *ClientConn) register(requestID string, bufferSize int) chan rpcResult {
+	cc.startRead.Do(func() { go cc.readLoop() })
+
+	// Room for a DUPLICATE answer to a retry plus the real response.
+	resultChan := make(chan rpcResult, 2)
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.closed {
+		resultChan <- rpcResult{err: net.ErrClosed}
+		return resultChan
+	}
+	cc.pending[requestID] = &pendingCall{result: resultChan, bufferSize: bufferSize}
+
+	return resultChan
+}
+
+func (cc *ClientConn) unregister(requestID string) {
+	cc.mu.Lock()
+	delete(cc.pending, requestID)
+	delete(cc.streams, requestID)
+	cc.mu.Unlock()
+}
+
+func (cc *ClientConn) lookup(requestID string) (chan rpcResult, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	call, ok := cc.pending[requestID]
+	if !ok {
+		return nil, false
+	}
+
+	return call.result, true
+}
+
+// bufferSize returns the largest response the caller waiting on
+// requestID accepts.
+func (cc *ClientConn) bufferSize(requestID string) (int, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	call, ok := cc.pending[requestID]
+	if !ok {
+		return 0, false
+	}
+
+	return call.bufferSize, true
+}
+
+// readLoop reads responses until Conn is closed and hands each one to the
+// caller waiting on its RequestID. Responses nobody is waiting for, and
+// extra copies of one already delivered, are dropped. When the loop ends
+// every waiting caller gets an error instead of sitting out its timeout.
+func (cc *ClientConn) readLoop() {
+	defer cc.failPending(net.ErrClosed)
+
+	// One byte more than the largest response, so a datagram the read
+	// cut short always fills the buffer and cannot pass for a whole one.
+	buffer := make([]byte, defaultBufferSize+1)
+
+	for {
+		n, _, err := cc.Conn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("reading response", "error", err)
+			continue
+		}
+
+		// A datagram that fills the buffer was cut short, so report that
+		// instead of a confusing JSON error.
+		if n == len(buffer) {
+			if requestID, ok := peekRequestID(buffer[:n]); ok {
+				cc.deliver(requestID, rpcResult{
+					err: fmt.Errorf("response truncated: more than %d bytes", defaultBufferSize),
+				})
+			}
+			continue
+		}
+
+		var resp RPCResponse
+		if err := json.Unmarshal(buffer[:n], &resp); err != nil {
+			slog.Error("parsing response", "error", err)
+			continue
+		}
+
+		// The caller would have read only its buffer's worth.
+		if limit, ok := cc.bufferSize(resp.RequestID); ok && n > limit {
+			cc.deliver(resp.RequestID, rpcResult{
+				err: fmt.Errorf("response truncated: %d-byte response, buffer size is %d", n, limit),
+			})
+			continue
+		}
+
+		if resp.Compressed {
+			inner, err := decompressResponse(&resp)
+			if err != nil {
+				cc.deliver(resp.RequestID, rpcResult{err: err})
+				continue
+			}
+			resp = *inner
+		}
+
+		if resp.Stream {
+			whole, ok := cc.assemble(&resp)
+			if !ok {
+				continue
+			}
+			resp = *whole
+		}
+
+		cc.deliver(resp.RequestID, rpcResult{resp: &resp})
+	}
+}
+
+// assemble adds a streamed part to its request's assembly and returns the
+// whole response once all parts are in.
+func (cc *ClientConn) assemble(part *RPCResponse) (*RPCResponse, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if _, ok := cc.pending[part.RequestID]; !ok {
+		return nil, false
+	}
+
+	assembly, ok := cc.streams[part.RequestID]
+	if !ok {
+		assembly = &streamAssembly{parts: make(map[int][]interface{})}
+		cc.streams[part.RequestID] = assembly
+	}
+
+	whole, done := assembly.add(part)
+	if done {
+		delete(cc.streams, part.RequestID)
+	}
+
+	return whole, done
+}
+
+// failPending ends every pending call with err. No calls are accepted
+// afterwards, since no read loop is left to answer them.
+func (cc *ClientConn) failPending(err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.closed = true
+	for _, call := range cc.pending {
+		select {
+		case call.result <- rpcResult{err: err}:
+		default:
+		}
+	}
+	clear(cc.streams)
+}
+
+func (cc *ClientConn) deliver(requestID string, result rpcResult) {
+	resultChan, ok := cc.lookup(requestID)
+	if !ok {
+		return
+	}
+
+	select {
+	case resultChan <- result:
+	default:
+	}
+}
+
+// peekRequestID pulls request_id out of a possibly incomplete response.
+// It relies on request_id being the first field RPCResponse marshals.
+func peekRequestID(data []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", false
+	}
+	if tok, err := dec.Token(); err != nil || tok != "request_id" {
+		return "", false
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return "", false
+	}
+	requestID, ok := tok.(string)
+
+	return requestID, ok
+}
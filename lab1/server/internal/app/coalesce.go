@@ -0,0 +1,84 @@
+package app
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// flight is one in-progress coalesced call. Its result is set before
+// done is closed.
+type flight struct {
+	done chan struct{}
+	resp *RPCResponse
+	err  error
+}
+
+// coalescer shares one call between identical concurrent callers.
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// CoalesceStats counts CallCoalesced calls since the client was created.
+// Hits joined a call already in flight and misses made their own, so
+// SavedSends, the requests that were never sent, equals Hits.
+type CoalesceStats struct {
+	Hits       uint64 `json:"hits"`
+	Misses     uint64 `json:"misses"`
+	SavedSends uint64 `json:"saved_sends"`
+}
+
+// CoalesceStats returns the client's CallCoalesced counters.
+func (c *RPCClient) CoalesceStats() CoalesceStats {
+	hits := c.coalesce.hits.Load()
+
+	return CoalesceStats{
+		Hits:       hits,
+		Misses:     c.coalesce.misses.Load(),
+		SavedSends: hits,
+	}
+}
+
+// CallCoalesced is Call, except that concurrent calls with the same key
+// share one request and all get its response. An empty key derives one
+// from method and params. Only calls that overlap in time are merged, so
+// use it for reads whose answer may be shared.
+func (c *RPCClient) CallCoalesced(key string, method string, params map[string]interface{}) (*RPCResponse, error) {
+	if key == "" {
+		// Maps marshal with sorted keys, so equal params give equal keys.
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		key = method + "\x00" + string(encoded)
+	}
+
+	c.coalesce.mu.Lock()
+	if f, ok := c.coalesce.flights[key]; ok {
+		c.coalesce.mu.Unlock()
+		c.coalesce.hits.Add(1)
+		<-f.done
+		return f.resp, f.err
+	}
+
+	f := &flight{done: make(chan struct{})}
+	if c.coalesce.flights == nil {
+		c.coalesce.flights = make(map[string]*flight)
+	}
+	c.coalesce.flights[key] = f
+	c.coalesce.mu.Unlock()
+	c.coalesce.misses.Add(1)
+
+	f.resp, f.err = c.Call(method, params)
+
+	c.coalesce.mu.Lock()
+	delete(c.coalesce.flights, key)
+	c.coalesce.mu.Unlock()
+	close(f.done)
+
+	return f.resp, f.err
+}
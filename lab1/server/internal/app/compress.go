@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxDecompressedSize bounds how far the client inflates a compressed
+// response, so a hostile server cannot exhaust its memory.
+const maxDecompressedSize = 1 << 20
+
+// compressResponse wraps an encoded response larger than the configured
+// threshold in a gzipped envelope. The envelope keeps the RequestID and
+// Status in the clear; Payload holds the whole original response. data
+// is returned unchanged when compression is off or does not help.
+func (s *Service) compressResponse(resp *RPCResponse, data []byte) []byte {
+	threshold := s.cfg.CompressThreshold
+	if threshold <= 0 || len(data) <= threshold {
+		return data
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return data
+	}
+
+	wrapped, err := s.encoder.Encode(&RPCResponse{
+		RequestID:  resp.RequestID,
+		Status:     resp.Status,
+		Compressed: true,
+		Payload:    base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+	if err != nil || len(wrapped) >= len(data) {
+		return data
+	}
+
+	return wrapped
+}
+
+// decompressResponse unpacks a response the server sent compressed.
+func decompressResponse(resp *RPCResponse) (*RPCResponse, error) {
+	compressed, err := base64.StdEncoding.DecodeString(resp.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("compressed payload is not valid base64: %v", err)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("reading compressed payload: %v", err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(zr, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading compressed payload: %v", err)
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("compressed payload inflates past %d bytes", maxDecompressedSize)
+	}
+
+	var inner RPCResponse
+	if err := json.Unmarshal(data, &inner); err != nil {
+		return nil, fmt.Errorf("parsing compressed payload: %v", err)
+	}
+
+	return &inner, nil
+}
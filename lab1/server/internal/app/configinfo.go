@@ -0,0 +1,64 @@
+package app
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// configInfo reports the loaded configuration so operators can check what
+// a running server actually uses. Config fields tagged `secret:"true"`
+// are redacted. The enabled methods are left to list_methods, which
+// streams them, to keep this reply within one datagram.
+func (s *Service) configInfo(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	info := map[string]interface{}{
+		"read_buffer_size": readBufferSize,
+		"method_count":     len(s.methods),
+	}
+
+	value := reflect.ValueOf(s.cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		name = strings.ToLower(name)
+
+		if field.Tag.Get("secret") == "true" {
+			if !value.Field(i).IsZero() {
+				info[name] = redacted
+			}
+			continue
+		}
+
+		info[name] = value.Field(i).Interface()
+	}
+
+	return info, nil
+}
+
+// listMethods streams the names of the enabled methods, sorted.
+func (s *Service) listMethods(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	names := s.methodNames()
+
+	items := make([]interface{}, len(names))
+	for i, name := range names {
+		items[i] = name
+	}
+
+	return &multiResult{items: items}, nil
+}
+
+func (s *Service) methodNames() []string {
+	names := make([]string, 0, len(s.methods))
+	for name := range s.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+func TestConfigInfo(t *testing.T) {
+	ts := newTestServer(t, &config.Config{
+		Port:           5000,
+		AdminToken:     "hunter2",
+		RequestTimeout: 2 * time.Second,
+		AllowCIDRs:     []string{"10.0.0.0/8"},
+	})
+
+	// The default client, with its default buffer, must be able to read
+	// the whole reply.
+	resp := ts.call(t, "config", nil)
+	if resp.Status != "OK" {
+		t.Fatalf("status %s (%s)", resp.Status, resp.Error)
+	}
+
+	info, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		t.Fatalf("result %T, want an object", resp.Result)
+	}
+
+	tests := []struct {
+		key  string
+		want interface{}
+	}{
+		{"port", 5000},
+		{"admin_token", redacted},
+		{"request_timeout", 2 * time.Second},
+		{"allow_cidrs", []string{"10.0.0.0/8"}},
+		{"read_buffer_size", readBufferSize},
+		{"method_count", len(ts.methods)},
+	}
+
+	for _, tt := range tests {
+		if !jsonEqual(t, info[tt.key], tt.want) {
+			t.Errorf("%s = %v, want %v", tt.key, info[tt.key], tt.want)
+		}
+	}
+
+	if strings.Contains(string(mustMarshal(t, resp)), "hunter2") {
+		t.Error("the admin token leaked into the config reply")
+	}
+}
+
+func TestListMethods(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	resp := ts.call(t, "list_methods", nil)
+	names, ok := resp.Result.([]interface{})
+	if resp.Status != "OK" || !ok {
+		t.Fatalf("got %s %v", resp.Status, resp.Result)
+	}
+
+	if len(names) != len(ts.methods) {
+		t.Errorf("listed %d methods, want %d", len(names), len(ts.methods))
+	}
+
+	sorted := sort.SliceIsSorted(names, func(i, j int) bool {
+		return names[i].(string) < names[j].(string)
+	})
+	if !sorted {
+		t.Errorf("names are not sorted: %v", names)
+	}
+
+	for _, name := range names {
+		if _, ok := ts.methods[name.(string)]; !ok {
+			t.Errorf("listed unknown method %v", name)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// csvParse parses data as CSV. Every row must have as many fields as the
+// first. With has_header the first row names the columns and each
+// remaining row is returned as an object keyed by those names.
+func (s *Service) csvParse(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	data, ok := params["data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'data' must be a string")
+	}
+
+	delimiter, err := getOptionalString(params, "delimiter", ",")
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(delimiter) != 1 {
+		return nil, fmt.Errorf("parameter 'delimiter' must be a single character")
+	}
+
+	hasHeader, err := getOptionalBool(params, "has_header", false)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comma, _ = utf8.DecodeRuneInString(delimiter)
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'data' is not valid CSV: %v", err)
+	}
+
+	if !hasHeader {
+		if records == nil {
+			records = [][]string{}
+		}
+		return map[string]interface{}{"rows": records}, nil
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("parameter 'data' has no header row")
+	}
+
+	header := records[0]
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if seen[name] {
+			return nil, fmt.Errorf("header has duplicate column %q", name)
+		}
+		seen[name] = true
+	}
+
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return map[string]interface{}{"header": header, "rows": rows}, nil
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// namedLayouts are the time package layouts a client may ask for by name.
+var namedLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// strftimeDirectives maps strftime conversions to Go layout elements.
+// Only those with an exact Go equivalent are supported.
+var strftimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'%': "%",
+}
+
+// getLayout reads the layout parameter: a name from namedLayouts, a
+// strftime format (anything containing '%') or a Go reference layout.
+func getLayout(params map[string]interface{}) (string, error) {
+	raw, ok := params["layout"].(string)
+	if !ok {
+		return "", fmt.Errorf("parameter 'layout' must be a string")
+	}
+
+	layout := raw
+	if named, ok := namedLayouts[raw]; ok {
+		layout = named
+	} else if strings.Contains(raw, "%") {
+		converted, err := strftimeToLayout(raw)
+		if err != nil {
+			return "", err
+		}
+		layout = converted
+	}
+
+	// A layout without any date or time element formats as itself.
+	if (time.Time{}).Format(layout) == layout {
+		return "", fmt.Errorf("parameter 'layout' has no date or time fields")
+	}
+
+	return layout, nil
+}
+
+// strftimeToLayout converts a strftime format to a Go layout.
+func strftimeToLayout(format string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		if i == len(format) {
+			return "", fmt.Errorf("parameter 'layout' ends with a bare '%%'")
+		}
+
+		element, ok := strftimeDirectives[format[i]]
+		if !ok {
+			return "", fmt.Errorf("parameter 'layout' uses unsupported directive '%%%c'", format[i])
+		}
+		b.WriteString(element)
+	}
+
+	return b.String(), nil
+}
+
+// getLocation reads the optional IANA timezone parameter, UTC by default.
+func getLocation(params map[string]interface{}) (*time.Location, error) {
+	name, err := getOptionalString(params, "timezone", "UTC")
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'timezone' is not a known timezone: %q", name)
+	}
+
+	return loc, nil
+}
+
+// dateParse parses value with layout and returns it as a Unix timestamp
+// in seconds. A value without a zone is read in timezone.
+func (s *Service) dateParse(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, ok := params["value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' must be a string")
+	}
+
+	layout, err := getLayout(params)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := getLocation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q with layout %q: %v", value, layout, err)
+	}
+
+	return t.Unix(), nil
+}
+
+// dateFormat formats a Unix timestamp in seconds with layout, in
+// timezone.
+func (s *Service) dateFormat(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	timestamp, err := getInt(params, "timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := getLayout(params)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := getLocation(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return time.Unix(timestamp, 0).In(loc).Format(layout), nil
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const requestLogTTL = 5 * time.Minute
+
+// dedupKeyFunc derives the key a request is deduplicated under.
+type dedupKeyFunc func(req *RPCRequest) string
+
+// newDedupKey picks how requests are keyed for dedup, following the
+// DEDUP_KEY setting. "request_id", the default, keys on the RequestID
+// alone; "payload" also hashes in the method and params, so two
+// different requests that happen to share an ID both run.
+func newDedupKey(mode string) (dedupKeyFunc, error) {
+	switch mode {
+	case "", "request_id":
+		return func(req *RPCRequest) string { return req.RequestID }, nil
+	case "payload":
+		return payloadDedupKey, nil
+	default:
+		return nil, fmt.Errorf("unknown dedup key %q, expected request_id or payload", mode)
+	}
+}
+
+// payloadDedupKey hashes the RequestID, method and params. Params marshal
+// with sorted keys, so a resend of the same request gets the same key.
+func payloadDedupKey(req *RPCRequest) string {
+	params, _ := json.Marshal(req.Params)
+
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(req.RequestID), []byte(req.Method), params} {
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupStore remembers recently seen request IDs so a retried request is
+// executed at most once.
+type dedupStore interface {
+	// MarkSeen records requestID and reports whether it was already
+	// recorded. Checking and recording happen atomically.
+	MarkSeen(requestID string) bool
+
+	// Reset forgets every ID and returns how many were still live, i.e.
+	// would have been answered DUPLICATE.
+	Reset() int
+}
+
+// requestLog is the in-memory dedupStore. A single mutex guards the map,
+// and expired IDs are swept from MarkSeen at most once per TTL, so no
+// per-request goroutines are needed.
+type requestLog struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func newRequestLog(ttl time.Duration) *requestLog {
+	return &requestLog{
+		ttl:       ttl,
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *requestLog) MarkSeen(requestID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.ttl {
+		l.evictLocked(now)
+	}
+
+	if at, ok := l.seen[requestID]; ok && now.Sub(at) < l.ttl {
+		return true
+	}
+	l.seen[requestID] = now
+
+	return false
+}
+
+func (l *requestLog) Reset() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Expired IDs may still be in the map until the next sweep; they are
+	// forgotten already and should not count.
+	l.evictLocked(l.now())
+	n := len(l.seen)
+	clear(l.seen)
+
+	return n
+}
+
+// evictLocked forgets IDs older than the TTL. It must be called with mu
+// held.
+func (l *requestLog) evictLocked(now time.Time) {
+	for id, at := range l.seen {
+		if now.Sub(at) >= l.ttl {
+			delete(l.seen, id)
+		}
+	}
+	l.lastSweep = now
+}
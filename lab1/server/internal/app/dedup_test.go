@@ -0,0 +1,105 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestLog(t *testing.T) {
+	now := time.Unix(0, 0)
+	log := newRequestLog(time.Minute)
+	log.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance time.Duration
+		id      string
+		seen    bool
+	}{
+		{0, "a", false},
+		{0, "a", true},
+		{30 * time.Second, "b", false},
+		{29 * time.Second, "a", true},
+		{time.Second, "a", false},
+		{30 * time.Second, "b", false},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		if got := log.MarkSeen(step.id); got != step.seen {
+			t.Errorf("step %d: MarkSeen(%q) = %v, want %v", i, step.id, got, step.seen)
+		}
+	}
+
+	// "a" expires; it is still in the map, but Reset counts only "b".
+	now = now.Add(45 * time.Second)
+	if n := log.Reset(); n != 1 {
+		t.Errorf("Reset cleared %d IDs, want 1", n)
+	}
+	if log.MarkSeen("a") {
+		t.Error("ID still seen after Reset")
+	}
+}
+
+// TestRequestLogConcurrent hammers one store from many goroutines with
+// inserts, repeats, sweeps and resets. Run it with -race.
+func TestRequestLogConcurrent(t *testing.T) {
+	// A TTL this short makes most MarkSeen calls sweep the map.
+	log := newRequestLog(time.Microsecond)
+
+	const workers, ids = 16, 500
+	var firsts atomic.Int64
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < ids; i++ {
+				// Every worker marks the same shared IDs, plus its own.
+				if !log.MarkSeen(fmt.Sprintf("shared-%d", i)) {
+					firsts.Add(1)
+				}
+				log.MarkSeen(fmt.Sprintf("own-%d-%d", w, i))
+				if i%100 == 0 {
+					log.Reset()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firsts.Load() < ids {
+		t.Errorf("%d shared IDs were reported new, want at least %d", firsts.Load(), ids)
+	}
+}
+
+// TestRequestLogAtMostOnce checks that of many concurrent calls with one
+// ID exactly one is told it is new.
+func TestRequestLogAtMostOnce(t *testing.T) {
+	log := newRequestLog(time.Minute)
+
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("id-%d", i)
+
+		var firsts atomic.Int64
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if !log.MarkSeen(id) {
+					firsts.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if firsts.Load() != 1 {
+			t.Fatalf("%s was new to %d callers, want 1", id, firsts.Load())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// distance measures between two points of equal dimension using the
+// euclidean (default) or manhattan metric.
+func (s *Service) distance(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	p1, err := s.getNumbers(params, "p1")
+	if err != nil {
+		return nil, err
+	}
+
+	p2, err := s.getNumbers(params, "p2")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p1) != len(p2) {
+		return nil, fmt.Errorf("points must have the same dimension, got %d and %d", len(p1), len(p2))
+	}
+
+	metric, err := getOptionalString(params, "metric", "euclidean")
+	if err != nil {
+		return nil, err
+	}
+
+	switch metric {
+	case "euclidean":
+		sum := 0.0
+		for i := range p1 {
+			d := p1[i] - p2[i]
+			sum += d * d
+		}
+		return math.Sqrt(sum), nil
+	case "manhattan":
+		sum := 0.0
+		for i := range p1 {
+			sum += math.Abs(p1[i] - p2[i])
+		}
+		return sum, nil
+	default:
+		return nil, fmt.Errorf("parameter 'metric' must be 'euclidean' or 'manhattan'")
+	}
+}
+
+// earthRadiusKm is the mean radius of the Earth.
+const earthRadiusKm = 6371.0088
+
+// geoDistance returns the great-circle distance between two points given
+// in degrees, in km (default) or mi, using the haversine formula.
+func (s *Service) geoDistance(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	coords := make(map[string]float64, 4)
+	for _, name := range []string{"lat1", "lon1", "lat2", "lon2"} {
+		value, ok := s.getFloat(params[name])
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' must be a number", name)
+		}
+
+		limit := 180.0
+		if strings.HasPrefix(name, "lat") {
+			limit = 90
+		}
+		if math.Abs(value) > limit {
+			return nil, fmt.Errorf("parameter '%s' must be between -%g and %g", name, limit, limit)
+		}
+
+		coords[name] = value * math.Pi / 180
+	}
+
+	unit, err := getOptionalString(params, "unit", "km")
+	if err != nil {
+		return nil, err
+	}
+
+	radius := earthRadiusKm
+	switch unit {
+	case "km":
+	case "mi":
+		radius = earthRadiusKm / 1.609344
+	default:
+		return nil, fmt.Errorf("parameter 'unit' must be 'km' or 'mi'")
+	}
+
+	dLat := coords["lat2"] - coords["lat1"]
+	dLon := coords["lon2"] - coords["lon1"]
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(coords["lat1"])*math.Cos(coords["lat2"])*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * radius * math.Asin(math.Sqrt(min(h, 1))), nil
+}
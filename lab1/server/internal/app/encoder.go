@@ -0,0 +1,91 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ResponseEncoder turns a response into the datagram sent to the client.
+// The server's encoder is picked with the RESPONSE_ENVELOPE setting.
+type ResponseEncoder interface {
+	Encode(resp *RPCResponse) ([]byte, error)
+}
+
+func newResponseEncoder(envelope string) (ResponseEncoder, error) {
+	switch envelope {
+	case "", "default":
+		return defaultEncoder{}, nil
+	case "ok_data":
+		return okDataEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown response envelope %q, expected default or ok_data", envelope)
+	}
+}
+
+// defaultEncoder sends RPCResponse as is. It is the only envelope
+// RPCClient understands.
+type defaultEncoder struct{}
+
+func (defaultEncoder) Encode(resp *RPCResponse) ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+// okDataEncoder sends {"ok": true, "data": ...} for clients that expect
+// that shape. A failed request has ok false, and its status other than
+// ERROR goes in code.
+type okDataEncoder struct{}
+
+type okDataEnvelope struct {
+	RequestID string      `json:"request_id"`
+	OK        bool        `json:"ok"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorData interface{} `json:"error_data,omitempty"`
+	Code      string      `json:"code,omitempty"`
+
+	Stream bool   `json:"stream,omitempty"`
+	Seq    int    `json:"seq,omitempty"`
+	Final  bool   `json:"final,omitempty"`
+	Nonce  string `json:"nonce,omitempty"`
+
+	Timestamp    int64 `json:"timestamp,omitempty"`
+	ProcessingMs int64 `json:"processing_ms,omitempty"`
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+
+	Compressed bool   `json:"compressed,omitempty"`
+	Payload    string `json:"payload,omitempty"`
+
+	UploadDigest string `json:"upload_digest,omitempty"`
+
+	Partial bool `json:"partial,omitempty"`
+}
+
+func (okDataEncoder) Encode(resp *RPCResponse) ([]byte, error) {
+	env := okDataEnvelope{
+		RequestID: resp.RequestID,
+		OK:        resp.Status == "OK",
+		Data:      resp.Result,
+		Error:     resp.Error,
+		ErrorData: resp.ErrorData,
+		Stream:    resp.Stream,
+		Seq:       resp.Seq,
+		Final:     resp.Final,
+		Nonce:     resp.Nonce,
+
+		Timestamp:    resp.Timestamp,
+		ProcessingMs: resp.ProcessingMs,
+		RetryAfterMs: resp.RetryAfterMs,
+
+		Compressed: resp.Compressed,
+		Payload:    resp.Payload,
+
+		UploadDigest: resp.UploadDigest,
+
+		Partial: resp.Partial,
+	}
+	if !env.OK && resp.Status != "ERROR" {
+		env.Code = resp.Status
+	}
+
+	return json.Marshal(env)
+}
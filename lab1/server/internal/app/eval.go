@@ -0,0 +1,165 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+func (s *Service) eval(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	expr, ok := params["expr"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'expr' must be a string")
+	}
+
+	p := &exprParser{input: []rune(expr)}
+
+	result, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected character %q at position %d", p.input[p.pos], p.pos)
+	}
+
+	return result, nil
+}
+
+// exprParser is a recursive-descent parser for arithmetic expressions:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = ("+" | "-") factor | number | "(" expr ")"
+type exprParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *exprParser) parseExpr() (float64, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) {
+			return left, nil
+		}
+
+		op := p.input[p.pos]
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseTerm() (float64, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) {
+			return left, nil
+		}
+
+		op := p.input[p.pos]
+		if op != '*' && op != '/' {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseFactor()
+		if err != nil {
+			return 0, err
+		}
+
+		if op == '*' {
+			left *= right
+			continue
+		}
+
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		left /= right
+	}
+}
+
+func (p *exprParser) parseFactor() (float64, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+
+	switch ch := p.input[p.pos]; {
+	case ch == '+' || ch == '-':
+		p.pos++
+		value, err := p.parseFactor()
+		if err != nil {
+			return 0, err
+		}
+		if ch == '-' {
+			value = -value
+		}
+		return value, nil
+
+	case ch == '(':
+		p.pos++
+		value, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+		p.pos++
+		return value, nil
+
+	case unicode.IsDigit(ch) || ch == '.':
+		return p.parseNumber()
+
+	default:
+		return 0, fmt.Errorf("unexpected character %q at position %d", ch, p.pos)
+	}
+}
+
+func (p *exprParser) parseNumber() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+
+	literal := string(p.input[start:p.pos])
+
+	value, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q at position %d", literal, start)
+	}
+
+	return value, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"fmt"
+	"math/big"
+)
+
+const (
+	// trialDivisionBound caps trial division for n above maxExactInteger,
+	// where dividing all the way to the square root is out of reach.
+	trialDivisionBound = 1 << 20
+
+	// maxFactorizeDigits bounds the length of n given as a string.
+	maxFactorizeDigits = 100
+)
+
+// factorize returns the prime factors of n in ascending order, repeated
+// by multiplicity. The list is streamed, so large results are fine. With
+// grouped set it returns each prime with its multiplicity instead, e.g.
+// {"2": 3, "3": 1} for 24.
+//
+// n may be a decimal string to go beyond 2^53. Such an n is only divided
+// by primes up to trialDivisionBound; a cofactor left over must be prime,
+// or the call fails.
+//
+// With allow_partial set, a call that hits its method timeout answers
+// {"factors": [...], "remaining": "..."} with the factors found so far
+// and the part of n not yet factored, instead of failing with TIMEOUT.
+func (s *Service) factorize(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	n, err := getBigInteger(params, "n")
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() < 1 {
+		return nil, fmt.Errorf("parameter 'n' must be a positive integer")
+	}
+
+	grouped, err := getOptionalBool(params, "grouped", false)
+	if err != nil {
+		return nil, err
+	}
+
+	allowPartial, err := getOptionalBool(params, "allow_partial", false)
+	if err != nil {
+		return nil, err
+	}
+
+	var factors []*big.Int
+	var rest *big.Int
+	if n.IsInt64() && n.Int64() <= maxExactInteger {
+		factors, rest, err = factorSmall(ctx, n.Int64())
+	} else {
+		factors, rest, err = factorBig(ctx, n)
+	}
+	if err != nil {
+		if allowPartial && ctx.Err() != nil {
+			return &partialResult{value: map[string]interface{}{
+				"factors":   factorList(factors, grouped),
+				"remaining": rest.String(),
+			}}, nil
+		}
+		return nil, err
+	}
+
+	if grouped {
+		return factorList(factors, true), nil
+	}
+
+	return &multiResult{items: factorList(factors, false).([]interface{})}, nil
+}
+
+// factorList formats factors as a list, or as a map of each prime to its
+// multiplicity when grouped.
+func factorList(factors []*big.Int, grouped bool) interface{} {
+	if grouped {
+		counts := make(map[string]int, len(factors))
+		for _, f := range factors {
+			counts[f.String()]++
+		}
+		return counts
+	}
+
+	items := make([]interface{}, 0, len(factors))
+	for _, f := range factors {
+		if f.IsInt64() && f.Int64() <= maxExactInteger {
+			items = append(items, f.Int64())
+		} else {
+			items = append(items, f.String())
+		}
+	}
+
+	return items
+}
+
+// factorSmall factors n completely by trial division. If the call is
+// cancelled first, it returns the factors found so far and the cofactor
+// still to be factored along with the error.
+func factorSmall(ctx *CallContext, n int64) ([]*big.Int, *big.Int, error) {
+	factors := make([]*big.Int, 0)
+	for p := int64(2); p*p <= n; p++ {
+		// Trial division on a large prime can outlive the method timeout.
+		if p%4096 == 0 && ctx.Err() != nil {
+			return factors, big.NewInt(n), ctx.Err()
+		}
+		for n%p == 0 {
+			factors = append(factors, big.NewInt(p))
+			n /= p
+		}
+	}
+	if n > 1 {
+		factors = append(factors, big.NewInt(n))
+	}
+
+	return factors, nil, nil
+}
+
+// factorBig divides n by candidates up to trialDivisionBound and then
+// requires whatever is left to be prime. Like factorSmall, it returns
+// the partial factorization when cancelled.
+func factorBig(ctx *CallContext, n *big.Int) ([]*big.Int, *big.Int, error) {
+	factors := make([]*big.Int, 0)
+	rest := new(big.Int).Set(n)
+	p, q, r := new(big.Int), new(big.Int), new(big.Int)
+
+	for i := int64(2); i <= trialDivisionBound; i++ {
+		if i%4096 == 0 && ctx.Err() != nil {
+			return factors, rest, ctx.Err()
+		}
+
+		p.SetInt64(i)
+		if new(big.Int).Mul(p, p).Cmp(rest) > 0 {
+			break
+		}
+		for {
+			q.QuoRem(rest, p, r)
+			if r.Sign() != 0 {
+				break
+			}
+			factors = append(factors, big.NewInt(i))
+			rest.Set(q)
+		}
+	}
+
+	if rest.Cmp(big.NewInt(1)) > 0 {
+		if !rest.ProbablyPrime(20) {
+			return nil, nil, &MethodError{
+				Message: fmt.Sprintf("cannot factor n: %s has no prime factor up to %d", rest, trialDivisionBound),
+				Data:    map[string]interface{}{"remaining": rest.String()},
+			}
+		}
+		factors = append(factors, rest)
+	}
+
+	return factors, nil, nil
+}
+
+// getBigInteger reads an integer given as a JSON number or, for values
+// beyond 2^53, as a decimal string.
+func getBigInteger(params map[string]interface{}, name string) (*big.Int, error) {
+	if digits, ok := params[name].(string); ok {
+		if len(digits) > maxFactorizeDigits {
+			return nil, fmt.Errorf("parameter '%s' must have at most %d digits", name, maxFactorizeDigits)
+		}
+
+		n, ok := new(big.Int).SetString(digits, 10)
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' must be a whole number", name)
+		}
+		return n, nil
+	}
+
+	value, err := getInt(params, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return big.NewInt(value), nil
+}
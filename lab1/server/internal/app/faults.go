@@ -0,0 +1,32 @@
+package app
+
+import (
+	"math/rand"
+	"time"
+)
+
+// faultDelay is how long a request picked for a simulated delay is held,
+// longer than the client's default timeout.
+const faultDelay = 3 * time.Second
+
+// injectTransient reports whether req was picked to fail with TRANSIENT,
+// at the configured FaultTransientRate.
+func (s *Service) injectTransient(req *RPCRequest) bool {
+	if rand.Float64() >= s.cfg.FaultTransientRate {
+		return false
+	}
+
+	s.logger.Info("simulating transient error", "request_id", req.RequestID)
+
+	return true
+}
+
+// injectDelay holds req for faultDelay at the configured FaultDelayRate.
+func (s *Service) injectDelay(req *RPCRequest) {
+	if rand.Float64() >= s.cfg.FaultDelayRate {
+		return
+	}
+
+	s.logger.Info("simulating delay", "request_id", req.RequestID)
+	time.Sleep(faultDelay)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// defaultMaxFibonacciN keeps F(n) comfortably under the default response
+// size; F(1000) has 209 digits.
+const defaultMaxFibonacciN = 1000
+
+// maxExactInt is maxExactInteger as a big.Int.
+var maxExactInt = big.NewInt(maxExactInteger)
+
+func (s *Service) maxFibonacciN() int64 {
+	if s.cfg.MaxFibonacciN > 0 {
+		return int64(s.cfg.MaxFibonacciN)
+	}
+
+	return defaultMaxFibonacciN
+}
+
+// fibonacci returns F(n), with F(0) = 0 and F(1) = 1. Values too large
+// to be exact as a JSON number are returned as a decimal string.
+func (s *Service) fibonacci(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	n, err := getInt(params, "n")
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("parameter 'n' must not be negative")
+	}
+	if limit := s.maxFibonacciN(); n > limit {
+		return nil, fmt.Errorf("parameter 'n' must be at most %d", limit)
+	}
+
+	a, b := big.NewInt(0), big.NewInt(1)
+	for i := int64(0); i < n; i++ {
+		a.Add(a, b)
+		a, b = b, a
+	}
+
+	if a.Cmp(maxExactInt) <= 0 {
+		return a.Int64(), nil
+	}
+
+	digits := a.String()
+	if limit := s.maxResponseSize(); len(digits) > limit {
+		return nil, &MethodError{
+			Message: fmt.Sprintf("result would exceed %d bytes", limit),
+			Data:    map[string]interface{}{"size": len(digits), "limit": limit},
+			Status:  "RESPONSE_TOO_LARGE",
+		}
+	}
+
+	return digits, nil
+}
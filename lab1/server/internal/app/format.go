@@ -0,0 +1,219 @@
+package app
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const maxFormatDecimals = 20
+
+func (s *Service) formatNumber(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, ok := params["value"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' must be a number")
+	}
+
+	decimals, err := getOptionalInt(params, "decimals", 2)
+	if err != nil {
+		return nil, err
+	}
+	if decimals < 0 || decimals > maxFormatDecimals {
+		return nil, fmt.Errorf("parameter 'decimals' must be between 0 and %d", maxFormatDecimals)
+	}
+
+	thousandsSep, err := getOptionalString(params, "thousands_sep", ",")
+	if err != nil {
+		return nil, err
+	}
+
+	decimalSep, err := getOptionalString(params, "decimal_sep", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	return groupNumber(value, int(decimals), thousandsSep, decimalSep), nil
+}
+
+// groupNumber formats value with a fixed number of decimals and inserts
+// thousandsSep between every three integer digits.
+func groupNumber(value float64, decimals int, thousandsSep, decimalSep string) string {
+	formatted := strconv.FormatFloat(value, 'f', decimals, 64)
+
+	negative := strings.HasPrefix(formatted, "-")
+	formatted = strings.TrimPrefix(formatted, "-")
+
+	intPart, fracPart, _ := strings.Cut(formatted, ".")
+
+	var b strings.Builder
+
+	// Values that round to zero are printed without a sign.
+	if negative && strings.Trim(intPart+fracPart, "0") != "" {
+		b.WriteByte('-')
+	}
+
+	for i, digit := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(thousandsSep)
+		}
+		b.WriteRune(digit)
+	}
+
+	if fracPart != "" {
+		b.WriteString(decimalSep)
+		b.WriteString(fracPart)
+	}
+
+	return b.String()
+}
+
+// toBase writes the integer value in base 2 to 36, using lowercase
+// letters for digits above 9.
+func (s *Service) toBase(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	base, err := getBase(params, "base")
+	if err != nil {
+		return nil, err
+	}
+
+	return formatInBase(params, int(base))
+}
+
+func (s *Service) toBinary(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	return formatInBase(params, 2)
+}
+
+func (s *Service) toHex(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	return formatInBase(params, 16)
+}
+
+func formatInBase(params map[string]interface{}, base int) (interface{}, error) {
+	value, err := getInt(params, "value")
+	if err != nil {
+		return nil, err
+	}
+
+	return strconv.FormatInt(value, base), nil
+}
+
+// baseConvert re-encodes the integer string value from from_base into
+// to_base. Unlike to_base it is not limited to what a JSON number can
+// hold exactly.
+func (s *Service) baseConvert(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, ok := params["value"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' must be a string")
+	}
+
+	from, err := getBase(params, "from_base")
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := getBase(params, "to_base")
+	if err != nil {
+		return nil, err
+	}
+
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" {
+		return nil, fmt.Errorf("parameter 'value' must not be empty")
+	}
+	for i, r := range digits {
+		if digitValue(r) >= from {
+			return nil, fmt.Errorf("invalid digit %q at position %d for base %d", r, i+len(value)-len(digits), from)
+		}
+	}
+
+	n, ok := new(big.Int).SetString(value, int(from))
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' is not a base %d integer", from)
+	}
+
+	converted := n.Text(int(to))
+	if limit := s.maxResponseSize(); len(converted) > limit {
+		return nil, &MethodError{
+			Message: fmt.Sprintf("result would exceed %d bytes", limit),
+			Data:    map[string]interface{}{"size": len(converted), "limit": limit},
+			Status:  "RESPONSE_TOO_LARGE",
+		}
+	}
+
+	return converted, nil
+}
+
+func getBase(params map[string]interface{}, name string) (int64, error) {
+	base, err := getInt(params, name)
+	if err != nil {
+		return 0, err
+	}
+	if base < 2 || base > 36 {
+		return 0, fmt.Errorf("parameter '%s' must be between 2 and 36", name)
+	}
+
+	return base, nil
+}
+
+// digitValue returns the value of a base 36 digit in either case, or 36
+// for anything that is not one.
+func digitValue(r rune) int64 {
+	switch {
+	case r >= '0' && r <= '9':
+		return int64(r - '0')
+	case r >= 'a' && r <= 'z':
+		return int64(r-'a') + 10
+	case r >= 'A' && r <= 'Z':
+		return int64(r-'A') + 10
+	default:
+		return 36
+	}
+}
+
+// maxRoundDecimals is as many decimals as a float64 can meaningfully hold.
+const maxRoundDecimals = 15
+
+// roundHalfEven rounds value to decimals places, sending exact ties to
+// the even neighbour (banker's rounding): 2.5 becomes 2 and 3.5 becomes
+// 4. Ties are judged on the shortest decimal form of value, so 2.675
+// counts as a tie even though its binary form is slightly below it.
+func (s *Service) roundHalfEven(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, ok := s.getFloat(params["value"])
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' must be a number")
+	}
+
+	decimals, err := getOptionalInt(params, "decimals", 0)
+	if err != nil {
+		return nil, err
+	}
+	if decimals < 0 || decimals > maxRoundDecimals {
+		return nil, fmt.Errorf("parameter 'decimals' must be between 0 and %d", maxRoundDecimals)
+	}
+
+	exact, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("parameter 'value' must be finite")
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)
+	scaled := new(big.Rat).Mul(exact, new(big.Rat).SetInt(scale))
+
+	// Split scaled into quotient and remainder, with a remainder of the
+	// same sign as the value.
+	quo, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	switch twice.Cmp(scaled.Denom()) {
+	case 1:
+		quo.Add(quo, big.NewInt(int64(rem.Sign())))
+	case 0:
+		if quo.Bit(0) == 1 {
+			quo.Add(quo, big.NewInt(int64(rem.Sign())))
+		}
+	}
+
+	rounded, _ := new(big.Rat).SetFrac(quo, scale).Float64()
+
+	return rounded, nil
+}
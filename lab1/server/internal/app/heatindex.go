@@ -0,0 +1,46 @@
+package app
+
+import (
+	"fmt"
+	"math"
+)
+
+// heatIndex computes the apparent temperature in °F from temp_f and
+// relative humidity (percent), following the NWS algorithm: Steadman's
+// simple formula for mild conditions and the Rothfusz regression with its
+// low and high humidity adjustments otherwise. The result is rounded to
+// one decimal.
+func (s *Service) heatIndex(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	t, ok := s.getFloat(params["temp_f"])
+	if !ok {
+		return nil, fmt.Errorf("parameter 'temp_f' must be a number")
+	}
+	if t < -80 || t > 150 {
+		return nil, fmt.Errorf("parameter 'temp_f' must be between -80 and 150")
+	}
+
+	rh, ok := s.getFloat(params["humidity"])
+	if !ok {
+		return nil, fmt.Errorf("parameter 'humidity' must be a number")
+	}
+	if rh < 0 || rh > 100 {
+		return nil, fmt.Errorf("parameter 'humidity' must be between 0 and 100")
+	}
+
+	hi := 0.5 * (t + 61 + (t-68)*1.2 + rh*0.094)
+
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh -
+			0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+			0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+
+		switch {
+		case rh < 13 && t >= 80 && t <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(t-95))/17)
+		case rh > 85 && t >= 80 && t <= 87:
+			hi += (rh - 85) / 10 * (87 - t) / 5
+		}
+	}
+
+	return math.Round(hi*10) / 10, nil
+}
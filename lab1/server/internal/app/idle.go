@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"time"
+)
+
+// idleDone returns a channel that is closed once no packet has arrived
+// for timeout. A zero timeout returns nil, which never becomes ready.
+func (s *Service) idleDone(ctx context.Context, timeout time.Duration) <-chan struct{} {
+	if timeout <= 0 {
+		return nil
+	}
+
+	s.traffic.lastPacket.Store(time.Now().UnixNano())
+	done := make(chan struct{})
+
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			idle := time.Since(time.Unix(0, s.traffic.lastPacket.Load()))
+			if idle >= timeout {
+				close(done)
+				return
+			}
+			timer.Reset(timeout - idle)
+		}
+	}()
+
+	return done
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"net"
+)
+
+// ipFilter decides whether a source address may send requests. A deny
+// match always wins, then an allow match admits; addresses in neither
+// list get the default. Sources without an IP, such as Unix socket peers,
+// are not filtered.
+type ipFilter struct {
+	allow       []*net.IPNet
+	deny        []*net.IPNet
+	defaultDeny bool
+}
+
+// newIPFilter returns nil when no lists and no deny default are set.
+func newIPFilter(allow, deny []string, defaultPolicy string) (*ipFilter, error) {
+	f := &ipFilter{}
+
+	switch defaultPolicy {
+	case "", "allow":
+	case "deny":
+		f.defaultDeny = true
+	default:
+		return nil, fmt.Errorf("unknown IP default policy %q, expected allow or deny", defaultPolicy)
+	}
+
+	var err error
+	if f.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+
+	if len(f.allow) == 0 && len(f.deny) == 0 && !f.defaultDeny {
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+// allowed reports whether addr may be served. A nil filter allows all.
+func (f *ipFilter) allowed(addr net.Addr) bool {
+	if f == nil {
+		return true
+	}
+
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return true
+	}
+
+	if containsIP(f.deny, udpAddr.IP) {
+		return false
+	}
+	if containsIP(f.allow, udpAddr.IP) {
+		return true
+	}
+
+	return !f.defaultDeny
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
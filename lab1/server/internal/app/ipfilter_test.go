@@ -0,0 +1,169 @@
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+// serveUDP serves a Service built from cfg on a loopback UDP socket. The
+// IP filter only applies to UDP sources, so these tests cannot use the
+// in-memory network.
+func serveUDP(t *testing.T, cfg *config.Config) (*Service, net.Addr) {
+	t.Helper()
+
+	service, err := NewService(cfg)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	go service.Serve(conn)
+	t.Cleanup(func() { conn.Close() })
+
+	return service, conn.LocalAddr()
+}
+
+// exchangeUDP sends data to server from a fresh loopback socket and
+// returns the reply, or false if none comes within timeout.
+func exchangeUDP(t *testing.T, server net.Addr, data []byte, timeout time.Duration) ([]byte, bool) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteTo(data, server); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buffer := make([]byte, defaultBufferSize)
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		return nil, false
+	}
+
+	return buffer[:n], true
+}
+
+func TestIPFilter(t *testing.T) {
+	chunk, err := splitRequest("big", make([]byte, 2*requestChunkSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cfg    config.Config
+		data   []byte
+		status string // empty means no reply
+	}{
+		{
+			name:   "allowed",
+			cfg:    config.Config{AllowCIDRs: []string{"127.0.0.0/8"}, IPDefaultPolicy: "deny"},
+			data:   rawRequest(t, "r1", "add", params{"a": 1, "b": 2}),
+			status: "OK",
+		},
+		{
+			name:   "denied",
+			cfg:    config.Config{DenyCIDRs: []string{"127.0.0.0/8"}},
+			data:   rawRequest(t, "r1", "add", params{"a": 1, "b": 2}),
+			status: "FORBIDDEN",
+		},
+		{
+			name:   "deny wins over allow",
+			cfg:    config.Config{AllowCIDRs: []string{"127.0.0.1/32"}, DenyCIDRs: []string{"127.0.0.0/8"}},
+			data:   rawRequest(t, "r1", "add", params{"a": 1, "b": 2}),
+			status: "FORBIDDEN",
+		},
+		{
+			name:   "unlisted under default deny",
+			cfg:    config.Config{AllowCIDRs: []string{"10.0.0.0/8"}, IPDefaultPolicy: "deny"},
+			data:   rawRequest(t, "r1", "add", params{"a": 1, "b": 2}),
+			status: "FORBIDDEN",
+		},
+		{
+			name:   "unlisted under default allow",
+			cfg:    config.Config{DenyCIDRs: []string{"10.0.0.0/8"}},
+			data:   rawRequest(t, "r1", "add", params{"a": 1, "b": 2}),
+			status: "OK",
+		},
+		{
+			name: "denied malformed datagram",
+			cfg:  config.Config{DenyCIDRs: []string{"127.0.0.0/8"}},
+			data: []byte("{not json"),
+		},
+		{
+			name: "denied request without a method",
+			cfg:  config.Config{DenyCIDRs: []string{"127.0.0.0/8"}},
+			data: []byte(`{"request_id": "r1"}`),
+		},
+		{
+			name: "denied chunk",
+			cfg:  config.Config{DenyCIDRs: []string{"127.0.0.0/8"}},
+			data: chunk[0],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, addr := serveUDP(t, &tt.cfg)
+
+			data, ok := exchangeUDP(t, addr, tt.data, 200*time.Millisecond)
+			if tt.status == "" {
+				if ok {
+					t.Fatalf("got a reply %s, want none", data)
+				}
+			} else {
+				if !ok {
+					t.Fatal("no reply")
+				}
+				if resp := decodeResponse(t, data); resp.Status != tt.status {
+					t.Errorf("status %s, want %s", resp.Status, tt.status)
+				}
+			}
+
+			denied := tt.status != "OK"
+			if got := service.traffic.deniedPackets.Load(); (got == 1) != denied {
+				t.Errorf("denied_packets = %d", got)
+			}
+
+			service.uploads.mu.Lock()
+			pending := len(service.uploads.uploads)
+			service.uploads.mu.Unlock()
+			if pending != 0 {
+				t.Errorf("%d uploads pending, want none", pending)
+			}
+		})
+	}
+}
+
+func TestIPFilterBeforeRateLimit(t *testing.T) {
+	service, addr := serveUDP(t, &config.Config{
+		DenyCIDRs:            []string{"127.0.0.0/8"},
+		MaxRequestsPerSecond: 1,
+	})
+
+	for i := 0; i < 3; i++ {
+		data, ok := exchangeUDP(t, addr, rawRequest(t, "r1", "add", nil), time.Second)
+		if !ok {
+			t.Fatal("no reply")
+		}
+		if resp := decodeResponse(t, data); resp.Status != "FORBIDDEN" {
+			t.Fatalf("request %d: status %s, want FORBIDDEN", i, resp.Status)
+		}
+	}
+
+	// Refused requests took no tokens, so the bucket is still full.
+	if wait := service.limiter.wait(); wait != 0 {
+		t.Errorf("limiter wants a %v wait, want a full bucket", wait)
+	}
+}
@@ -0,0 +1,54 @@
+package app
+
+import "fmt"
+
+// jsonMerge deep-merges object b into object a. Nested objects are merged
+// key by key; for any other conflict b wins, except that arrays are
+// concatenated when array_strategy is "concat".
+func (s *Service) jsonMerge(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, ok := params["a"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'a' must be an object")
+	}
+
+	b, ok := params["b"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'b' must be an object")
+	}
+
+	strategy, err := getOptionalString(params, "array_strategy", "replace")
+	if err != nil {
+		return nil, err
+	}
+	if strategy != "replace" && strategy != "concat" {
+		return nil, fmt.Errorf("parameter 'array_strategy' must be 'replace' or 'concat'")
+	}
+
+	return mergeObjects(a, b, strategy == "concat"), nil
+}
+
+// mergeObjects returns a new object; a and b are left unchanged.
+func mergeObjects(a, b map[string]interface{}, concatArrays bool) map[string]interface{} {
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for key, value := range a {
+		merged[key] = value
+	}
+
+	for key, value := range b {
+		switch bv := value.(type) {
+		case map[string]interface{}:
+			if av, ok := merged[key].(map[string]interface{}); ok {
+				merged[key] = mergeObjects(av, bv, concatArrays)
+				continue
+			}
+		case []interface{}:
+			if av, ok := merged[key].([]interface{}); ok && concatArrays {
+				merged[key] = append(append([]interface{}{}, av...), bv...)
+				continue
+			}
+		}
+		merged[key] = value
+	}
+
+	return merged
+}
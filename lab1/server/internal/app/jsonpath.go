@@ -0,0 +1,123 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath returns the value inside data at a path such as "a.b[0].c".
+func (s *Service) jsonPath(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	data, ok := params["data"]
+	if !ok {
+		return nil, fmt.Errorf("parameter 'data' is required")
+	}
+
+	path, ok := params["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'path' must be a string")
+	}
+
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := data
+	for i, step := range steps {
+		at := formatJSONPath(steps[:i])
+
+		if step.isIndex {
+			list, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("path does not resolve: %s is not an array", at)
+			}
+			if step.index < 0 || step.index >= len(list) {
+				return nil, fmt.Errorf("path does not resolve: index %d out of range at %s", step.index, at)
+			}
+			current = list[step.index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("path does not resolve: %s is not an object", at)
+		}
+		value, ok := object[step.key]
+		if !ok {
+			return nil, fmt.Errorf("path does not resolve: no key %q at %s", step.key, at)
+		}
+		current = value
+	}
+
+	return current, nil
+}
+
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath splits a path into object keys and array indices. Keys
+// are separated by dots; indices are written in brackets after a key.
+func parseJSONPath(path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, fmt.Errorf("parameter 'path' must not be empty")
+	}
+
+	var steps []pathStep
+	for _, segment := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(segment, "[")
+		if key == "" && (len(steps) > 0 || rest == "") {
+			return nil, fmt.Errorf("invalid path %q: empty key", path)
+		}
+		if key != "" {
+			steps = append(steps, pathStep{key: key})
+		}
+
+		for rest != "" {
+			literal, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid path %q: missing ']'", path)
+			}
+
+			index, err := strconv.Atoi(literal)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: bad index %q", path, literal)
+			}
+			steps = append(steps, pathStep{index: index, isIndex: true})
+
+			if after == "" {
+				break
+			}
+			if !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid path %q: unexpected %q", path, after)
+			}
+			rest = after[1:]
+		}
+	}
+
+	return steps, nil
+}
+
+// formatJSONPath renders steps back into path syntax for error messages.
+func formatJSONPath(steps []pathStep) string {
+	if len(steps) == 0 {
+		return "the root"
+	}
+
+	var b strings.Builder
+	for i, step := range steps {
+		if step.isIndex {
+			fmt.Fprintf(&b, "[%d]", step.index)
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(step.key)
+	}
+
+	return b.String()
+}
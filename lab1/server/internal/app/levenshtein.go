@@ -0,0 +1,95 @@
+package app
+
+import "fmt"
+
+// maxSuggestDistance is how many edits away a known method may be for it
+// to be suggested for an unknown one.
+const maxSuggestDistance = 2
+
+// maxLevenshteinCells caps len(a)*len(b) for the levenshtein method, so a
+// pair of long strings cannot hold a handler for seconds.
+const maxLevenshteinCells = 1 << 24
+
+// unknownMethodError reports an unknown method, suggesting the closest
+// registered name when one is only a typo away.
+func (s *Service) unknownMethodError(name string) error {
+	best, bestDistance := "", maxSuggestDistance+1
+
+	for _, candidate := range s.methodNames() {
+		if d := levenshtein([]rune(name), []rune(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	if best == "" {
+		return fmt.Errorf("unknown method: %s", name)
+	}
+
+	return fmt.Errorf("unknown method: %s (did you mean '%s'?)", name, best)
+}
+
+// levenshteinMethod returns the edit distance between a and b in runes,
+// or with normalized set a similarity from 0 (nothing shared) to 1
+// (identical).
+func (s *Service) levenshteinMethod(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, ok := params["a"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'a' must be a string")
+	}
+
+	b, ok := params["b"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'b' must be a string")
+	}
+
+	normalized, err := getOptionalBool(params, "normalized", false)
+	if err != nil {
+		return nil, err
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	if cells := len(ra) * len(rb); cells > maxLevenshteinCells {
+		return nil, &MethodError{
+			Message: fmt.Sprintf("inputs too long: %d x %d characters, their product may be at most %d", len(ra), len(rb), maxLevenshteinCells),
+			Data:    map[string]interface{}{"cells": cells, "limit": maxLevenshteinCells},
+		}
+	}
+
+	d := levenshtein(ra, rb)
+
+	if !normalized {
+		return d, nil
+	}
+
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1.0, nil
+	}
+
+	return 1 - float64(d)/float64(longest), nil
+}
+
+// levenshtein returns the edit distance between a and b, using two rows
+// of the usual dynamic programming table.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
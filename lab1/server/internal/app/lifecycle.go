@@ -0,0 +1,161 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+type serverState int32
+
+const (
+	stateReady serverState = iota
+	stateDraining
+	stateShuttingDown
+)
+
+func (st serverState) String() string {
+	switch st {
+	case stateReady:
+		return "ready"
+	case stateDraining:
+		return "draining"
+	case stateShuttingDown:
+		return "shutting_down"
+	default:
+		return "unknown"
+	}
+}
+
+// drainExempt lists methods still served while draining, so load
+// balancers can keep polling health.
+var drainExempt = map[string]bool{
+	"health": true,
+}
+
+func (s *Service) currentState() serverState {
+	return serverState(s.state.Load())
+}
+
+// advanceState moves the server to next. States only move forward, so a
+// late drain cannot undo a shutdown.
+func (s *Service) advanceState(next serverState) {
+	for {
+		current := s.state.Load()
+		if current >= int32(next) {
+			return
+		}
+		if s.state.CompareAndSwap(current, int32(next)) {
+			return
+		}
+	}
+}
+
+// track runs handle as an in-flight request that shutdown waits for.
+func (s *Service) track(handle func()) {
+	s.inFlight.Add(1)
+	s.inFlightCount.Add(1)
+
+	go func() {
+		defer s.inFlight.Done()
+		defer s.inFlightCount.Add(-1)
+
+		handle()
+	}()
+}
+
+// runningRequest is a parsed request being handled, kept so a shutdown
+// that gives up on it can say which it was.
+type runningRequest struct {
+	id     string
+	method string
+	start  time.Time
+}
+
+// running records req as being handled until the returned func is called.
+func (s *Service) running(req *RPCRequest, start time.Time) func() {
+	r := &runningRequest{id: req.RequestID, method: req.Method, start: start}
+	s.runningRequests.Store(r, struct{}{})
+
+	return func() { s.runningRequests.Delete(r) }
+}
+
+// logAbandoned logs each request still running when shutdown gives up.
+func (s *Service) logAbandoned() {
+	s.runningRequests.Range(func(key, _ interface{}) bool {
+		r := key.(*runningRequest)
+		s.logger.Warn("abandoned request", "request_id", r.id, "method", r.method, "running_for", time.Since(r.start))
+		return true
+	})
+}
+
+// stopReading unblocks a Serve loop on conn. A read deadline keeps the
+// conn open so in-flight requests can still reply; transports without
+// deadlines are closed instead.
+func stopReading(conn Transport) {
+	if d, ok := conn.(interface{ SetReadDeadline(time.Time) error }); ok {
+		if err := d.SetReadDeadline(time.Now()); err == nil {
+			return
+		}
+	}
+
+	conn.Close()
+}
+
+// drain stops the server from taking new requests. Requests already
+// running finish normally; new ones get DRAINING and health reports
+// not ready.
+func (s *Service) drain(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	s.advanceState(stateDraining)
+
+	return s.healthReport(), nil
+}
+
+func (s *Service) health(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	return s.healthReport(), nil
+}
+
+// healthReport describes the server state. Over RPC, in_flight counts
+// the request asking for it.
+func (s *Service) healthReport() map[string]interface{} {
+	state := s.currentState()
+
+	return map[string]interface{}{
+		"status":    state.String(),
+		"ready":     state == stateReady,
+		"in_flight": s.inFlightCount.Load(),
+	}
+}
+
+// serveReady answers 200 only while the server takes new requests, so an
+// orchestrator stops routing to it as soon as it starts draining.
+func (s *Service) serveReady(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, s.currentState() == stateReady)
+}
+
+// serveHealthz answers 200 until shutdown begins. A draining server is
+// still alive and finishing its requests.
+func (s *Service) serveHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeHealth(w, s.currentState() < stateShuttingDown)
+}
+
+func (s *Service) writeHealth(w http.ResponseWriter, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(s.healthReport())
+}
+
+// isTimeout reports whether err is a read deadline expiring.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
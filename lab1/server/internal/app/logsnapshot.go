@@ -0,0 +1,149 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// logRingSize is how many recent log lines the server keeps.
+	logRingSize = 256
+
+	// maxLogLineLength and logChunkSize keep each streamed datagram of
+	// log lines small.
+	maxLogLineLength = 200
+	logChunkSize     = 3
+)
+
+// logRing is an io.Writer that keeps the last logRingSize lines written
+// to it. The service logger writes into it so log_snapshot and tail_logs
+// can read it back.
+type logRing struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	partial []byte
+
+	// watchers get every line as it is added, for tail_logs. A watcher
+	// that is not keeping up misses lines rather than blocking logging.
+	watchers map[chan string]struct{}
+}
+
+func newLogRing() *logRing {
+	return &logRing{lines: make([]string, 0, logRingSize)}
+}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		r.add(string(data[:i]))
+		data = data[i+1:]
+	}
+	r.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+// add must be called with mu held.
+func (r *logRing) add(line string) {
+	for ch := range r.watchers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+
+	if len(r.lines) < logRingSize {
+		r.lines = append(r.lines, line)
+		return
+	}
+
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % logRingSize
+}
+
+// tail returns up to n of the most recent lines, oldest first.
+func (r *logRing) tail(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastLocked(n)
+}
+
+// lastLocked returns up to n of the most recent lines, oldest first. It
+// must be called with mu held.
+func (r *logRing) lastLocked(n int) []string {
+	ordered := append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+
+	return ordered[max(len(ordered)-n, 0):]
+}
+
+// watch returns the last n lines, like tail, and a channel that receives
+// every line added after them. stop ends the watch.
+func (r *logRing) watch(n, buffer int) (backlog []string, lines <-chan string, stop func()) {
+	ch := make(chan string, buffer)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.watchers == nil {
+		r.watchers = make(map[chan string]struct{})
+	}
+	r.watchers[ch] = struct{}{}
+
+	return r.lastLocked(n), ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.watchers, ch)
+	}
+}
+
+// cutLogLine shortens line to at most maxLogLineLength bytes without
+// splitting a UTF-8 sequence.
+func cutLogLine(line string) string {
+	if len(line) <= maxLogLineLength {
+		return line
+	}
+
+	cut := maxLogLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+
+	return line[:cut]
+}
+
+// logSnapshot returns the most recent server log lines, oldest first, as
+// they are when the request arrives. It does not follow the log: lines
+// written later need another call. Long lines are cut to
+// maxLogLineLength bytes.
+func (s *Service) logSnapshot(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	n, err := getOptionalInt(params, "lines", 50)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > logRingSize {
+		return nil, fmt.Errorf("parameter 'lines' must be between 1 and %d", logRingSize)
+	}
+
+	lines := s.logs.tail(int(n))
+	items := make([]interface{}, len(lines))
+	for i, line := range lines {
+		items[i] = cutLogLine(line)
+	}
+
+	return &multiResult{items: items, chunkSize: logChunkSize}, nil
+}
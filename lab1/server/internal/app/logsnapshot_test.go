@@ -0,0 +1,161 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+func TestLogRing(t *testing.T) {
+	r := newLogRing()
+
+	// A line may arrive over several writes.
+	fmt.Fprint(r, "first ")
+	fmt.Fprint(r, "line\nsecond line\nthird")
+	if got := r.tail(10); !jsonEqual(t, got, []string{"first line", "second line"}) {
+		t.Errorf("tail = %q", got)
+	}
+
+	for i := 0; i < logRingSize+5; i++ {
+		fmt.Fprintf(r, "line %d\n", i)
+	}
+
+	got := r.tail(logRingSize + 10)
+	if len(got) != logRingSize {
+		t.Fatalf("kept %d lines, want %d", len(got), logRingSize)
+	}
+	if got[0] != "line 5" || got[len(got)-1] != fmt.Sprintf("line %d", logRingSize+4) {
+		t.Errorf("kept %q to %q", got[0], got[len(got)-1])
+	}
+}
+
+func TestLogSnapshot(t *testing.T) {
+	tests := []struct {
+		name   string
+		logged string
+		params params
+		status string
+		want   []string
+	}{
+		{"last lines", "one\ntwo\nthree\n", params{"token": "secret", "lines": 2}, "OK", []string{"two", "three"}},
+		{"long lines cut", strings.Repeat("x", 2*maxLogLineLength) + "\n", params{"token": "secret", "lines": 1}, "OK", []string{strings.Repeat("x", maxLogLineLength)}},
+		{"cut on a rune boundary", strings.Repeat("x", maxLogLineLength-1) + "é\n", params{"token": "secret", "lines": 1}, "OK", []string{strings.Repeat("x", maxLogLineLength-1)}},
+		{"no token", "one\n", params{"lines": 2}, "UNAUTHORIZED", nil},
+		{"too many lines", "one\n", params{"token": "secret", "lines": logRingSize + 1}, "ERROR", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+
+			fmt.Fprint(ts.logs, tt.logged)
+
+			resp := ts.call(t, "log_snapshot", tt.params)
+			if resp.Status != tt.status {
+				t.Fatalf("status %s (%s), want %s", resp.Status, resp.Error, tt.status)
+			}
+			if tt.want != nil && !jsonEqual(t, resp.Result, tt.want) {
+				t.Errorf("result %v, want %v", resp.Result, tt.want)
+			}
+		})
+	}
+}
+
+// tailPart reads the next tail_logs part for the subscription id from
+// conn, skipping replies to other requests.
+func tailPart(t *testing.T, conn *MemTransport, id string) *RPCResponse {
+	t.Helper()
+
+	for {
+		data, ok := receive(conn, time.Second)
+		if !ok {
+			t.Fatal("no tail_logs part within a second")
+		}
+		if resp := decodeResponse(t, data); resp.RequestID == id {
+			if resp.Status != "OK" || !resp.Stream {
+				t.Fatalf("tail_logs: status %s (%s), stream %v", resp.Status, resp.Error, resp.Stream)
+			}
+			return resp
+		}
+	}
+}
+
+func TestTailLogs(t *testing.T) {
+	ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+	conn := ts.listen(t)
+
+	fmt.Fprint(ts.logs, "before\n")
+
+	first, _ := ts.exchange(t, conn, rawRequest(t, "tail", "tail_logs", params{"token": "secret", "lines": 1}), time.Second)
+	if resp := decodeResponse(t, first); resp.Seq != 0 || resp.Final || !jsonEqual(t, resp.Result, []string{"before"}) {
+		t.Fatalf("first part %+v, want the one backlog line", resp)
+	}
+
+	// Lines logged from now on are delivered, in order, as they happen.
+	ts.logger.Warn("first event")
+	ts.logger.Warn("second event")
+
+	var got []string
+	for seq := 1; len(got) < 2; seq++ {
+		resp := tailPart(t, conn, "tail")
+		if resp.Seq != seq || resp.Final {
+			t.Fatalf("part seq %d, final %v; want seq %d, not final", resp.Seq, resp.Final, seq)
+		}
+		for _, line := range resp.Result.([]interface{}) {
+			if strings.Contains(line.(string), "event") {
+				got = append(got, line.(string))
+			}
+		}
+	}
+	if !strings.Contains(got[0], "first event") || !strings.Contains(got[1], "second event") {
+		t.Errorf("delivered %q", got)
+	}
+
+	if resp := ts.call(t, "unsubscribe", params{"token": "secret", "subscription_id": "tail"}); !jsonEqual(t, resp.Result, params{"unsubscribed": true}) {
+		t.Fatalf("unsubscribe: %s %v (%s)", resp.Status, resp.Result, resp.Error)
+	}
+	for !tailPart(t, conn, "tail").Final {
+	}
+
+	if resp := ts.call(t, "unsubscribe", params{"token": "secret", "subscription_id": "tail"}); !jsonEqual(t, resp.Result, params{"unsubscribed": false}) {
+		t.Errorf("second unsubscribe: %v", resp.Result)
+	}
+}
+
+func TestTailLogsInactivity(t *testing.T) {
+	ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+	ts.tails.idle = 40 * time.Millisecond
+	conn := ts.listen(t)
+
+	ts.exchange(t, conn, rawRequest(t, "tail", "tail_logs", params{"token": "secret"}), time.Second)
+
+	// Requests from the subscriber keep the subscription going well past
+	// the idle timeout.
+	for i := 0; i < 15; i++ {
+		if _, err := conn.WriteTo(rawRequest(t, fmt.Sprintf("ping-%d", i), "health", nil), ts.conn.Addr()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ts.logger.Warn("still subscribed")
+	for {
+		resp := tailPart(t, conn, "tail")
+		if resp.Final {
+			t.Fatal("subscription ended while the client was active")
+		}
+		if strings.Contains(fmt.Sprint(resp.Result), "still subscribed") {
+			break
+		}
+	}
+
+	// Once the client goes quiet the subscription ends with a final part.
+	for !tailPart(t, conn, "tail").Final {
+	}
+	if ts.tails.end("tail") {
+		t.Error("ended subscription still registered")
+	}
+}
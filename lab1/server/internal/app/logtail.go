@@ -0,0 +1,219 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// tailIdleTimeout ends a tail_logs subscription whose client has sent
+	// nothing for this long. Any request from its address counts.
+	tailIdleTimeout = 30 * time.Second
+
+	// tailBuffer is how many lines a subscription may fall behind before
+	// it starts missing them.
+	tailBuffer = 64
+)
+
+// logTail is a tail_logs subscription. The method returns one, and
+// handleMessage hands it to the service's logTails to follow, since only
+// it knows the conn to push on.
+type logTail struct {
+	id      string
+	addr    net.Addr
+	backlog int
+
+	lastSeen time.Time
+	stop     chan struct{}
+}
+
+// logTails is the registry of live tail_logs subscriptions, keyed by the
+// RequestID of the tail_logs call.
+type logTails struct {
+	idle time.Duration
+
+	mu    sync.Mutex
+	tails map[string]*logTail
+	wg    sync.WaitGroup
+}
+
+func newLogTails() *logTails {
+	return &logTails{idle: tailIdleTimeout, tails: make(map[string]*logTail)}
+}
+
+// tailLogs subscribes the caller to the server log. See logTails.follow
+// for what is sent.
+func (s *Service) tailLogs(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	n, err := getOptionalInt(params, "lines", 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n > logRingSize {
+		return nil, fmt.Errorf("parameter 'lines' must be between 0 and %d", logRingSize)
+	}
+
+	return &logTail{id: ctx.RequestID, addr: ctx.Source, backlog: int(n)}, nil
+}
+
+// unsubscribe ends the tail_logs subscription with the given id.
+func (s *Service) unsubscribe(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	if err := s.requireAdmin(params); err != nil {
+		return nil, err
+	}
+
+	id, ok := params["subscription_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'subscription_id' must be a string")
+	}
+
+	return map[string]interface{}{"unsubscribed": s.tails.end(id)}, nil
+}
+
+// start registers tail and follows the log for it in the background.
+func (t *logTails) start(s *Service, conn Transport, resp *RPCResponse, tail *logTail) {
+	tail.lastSeen = time.Now()
+	tail.stop = make(chan struct{})
+
+	t.mu.Lock()
+	t.tails[tail.id] = tail
+	t.mu.Unlock()
+
+	// Watching starts here rather than in follow, so the backlog is the
+	// log as it was when the request was answered.
+	backlog, lines, stopWatching := s.logs.watch(tail.backlog, tailBuffer)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		defer stopWatching()
+		t.follow(s, conn, resp, tail, backlog, lines)
+	}()
+}
+
+// follow sends tail's client the backlog it asked for and then every new
+// log line, as stream parts of resp. The backlog goes at once, in at
+// least one part, which is empty when no backlog was asked for. When the
+// subscription ends, by
+// unsubscribe, inactivity or shutdown, an empty part with Final set is
+// sent last.
+func (t *logTails) follow(s *Service, conn Transport, resp *RPCResponse, tail *logTail, backlog []string, lines <-chan string) {
+	defer t.remove(tail.id)
+
+	seq := 0
+	send := func(batch []string, final bool) error {
+		items := make([]interface{}, len(batch))
+		for i, line := range batch {
+			items[i] = cutLogLine(line)
+		}
+
+		part := *resp
+		part.Result = items
+		part.Stream = true
+		part.Seq = seq
+		part.Final = final
+		seq++
+
+		data, err := s.encoder.Encode(&part)
+		if err != nil {
+			return err
+		}
+
+		return s.send(conn, data, tail.addr)
+	}
+
+	// The backlog goes in parts of logChunkSize like log_snapshot.
+	for {
+		n := min(len(backlog), logChunkSize)
+		if err := send(backlog[:n], false); err != nil {
+			return
+		}
+		backlog = backlog[n:]
+		if len(backlog) == 0 {
+			break
+		}
+	}
+
+	check := time.NewTicker(t.idle / 4)
+	defer check.Stop()
+
+	for {
+		select {
+		case line := <-lines:
+			batch := []string{line}
+			for len(batch) < logChunkSize && len(lines) > 0 {
+				batch = append(batch, <-lines)
+			}
+			if err := send(batch, false); err != nil {
+				return
+			}
+		case <-check.C:
+			if t.idleFor(tail) >= t.idle {
+				send(nil, true)
+				return
+			}
+		case <-tail.stop:
+			send(nil, true)
+			return
+		}
+	}
+}
+
+// touch notes activity from addr, keeping its subscriptions alive.
+func (t *logTails) touch(addr net.Addr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tail := range t.tails {
+		if tail.addr.String() == addr.String() {
+			tail.lastSeen = time.Now()
+		}
+	}
+}
+
+func (t *logTails) idleFor(tail *logTail) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return time.Since(tail.lastSeen)
+}
+
+// end stops the subscription with the given id and reports whether there
+// was one.
+func (t *logTails) end(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tail, ok := t.tails[id]
+	if ok {
+		delete(t.tails, id)
+		close(tail.stop)
+	}
+
+	return ok
+}
+
+func (t *logTails) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.tails, id)
+}
+
+// close ends every subscription and waits for their final parts to be
+// sent.
+func (t *logTails) close() {
+	t.mu.Lock()
+	for id, tail := range t.tails {
+		delete(t.tails, id)
+		close(tail.stop)
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
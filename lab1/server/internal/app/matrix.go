@@ -0,0 +1,78 @@
+package app
+
+import "fmt"
+
+// maxMatrixDim bounds the rows and columns of a matrix_multiply operand,
+// keeping the cubic multiplication cost in check.
+const maxMatrixDim = 100
+
+// matrixMultiply returns the product of the matrices a and b.
+func (s *Service) matrixMultiply(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, err := s.getMatrix(params, "a")
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.getMatrix(params, "b")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(a[0]) != len(b) {
+		return nil, fmt.Errorf("dimension mismatch: cannot multiply %dx%d by %dx%d",
+			len(a), len(a[0]), len(b), len(b[0]))
+	}
+
+	product := make([][]float64, len(a))
+	for i := range a {
+		product[i] = make([]float64, len(b[0]))
+		for j := range b[0] {
+			sum := 0.0
+			for k := range b {
+				sum += a[i][k] * b[k][j]
+			}
+			product[i][j] = sum
+		}
+	}
+
+	return product, nil
+}
+
+// getMatrix reads a non-empty rectangular array of number arrays.
+func (s *Service) getMatrix(params map[string]interface{}, name string) ([][]float64, error) {
+	rows, ok := params[name].([]interface{})
+	if !ok || len(rows) == 0 {
+		return nil, fmt.Errorf("parameter '%s' must be a non-empty array of rows", name)
+	}
+
+	if len(rows) > maxMatrixDim {
+		return nil, fmt.Errorf("parameter '%s' must have at most %d rows", name, maxMatrixDim)
+	}
+
+	matrix := make([][]float64, len(rows))
+	for i, raw := range rows {
+		row, ok := raw.([]interface{})
+		if !ok || len(row) == 0 {
+			return nil, fmt.Errorf("parameter '%s' row %d must be a non-empty array of numbers", name, i)
+		}
+
+		if len(row) > maxMatrixDim {
+			return nil, fmt.Errorf("parameter '%s' must have at most %d columns", name, maxMatrixDim)
+		}
+
+		if i > 0 && len(row) != len(matrix[0]) {
+			return nil, fmt.Errorf("parameter '%s' row %d has %d columns, expected %d", name, i, len(row), len(matrix[0]))
+		}
+
+		matrix[i] = make([]float64, len(row))
+		for j, elem := range row {
+			value, ok := s.getFloat(elem)
+			if !ok {
+				return nil, fmt.Errorf("parameter '%s' element [%d][%d] must be a number", name, i, j)
+			}
+			matrix[i][j] = value
+		}
+	}
+
+	return matrix, nil
+}
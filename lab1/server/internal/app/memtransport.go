@@ -0,0 +1,119 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// memQueueSize is how many datagrams a MemTransport buffers before
+// dropping, like a full socket receive buffer.
+const memQueueSize = 64
+
+// MemNetwork connects MemTransports by name so a server and clients can
+// exchange datagrams without real sockets.
+type MemNetwork struct {
+	mu    sync.Mutex
+	ports map[string]*MemTransport
+}
+
+func NewMemNetwork() *MemNetwork {
+	return &MemNetwork{ports: make(map[string]*MemTransport)}
+}
+
+// Listen binds a transport to name on the network.
+func (n *MemNetwork) Listen(name string) (*MemTransport, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.ports[name]; ok {
+		return nil, fmt.Errorf("address already in use: %s", name)
+	}
+
+	t := &MemTransport{
+		network: n,
+		addr:    MemAddr(name),
+		inbox:   make(chan memPacket, memQueueSize),
+		closed:  make(chan struct{}),
+	}
+	n.ports[name] = t
+
+	return t, nil
+}
+
+func (n *MemNetwork) lookup(name string) (*MemTransport, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	t, ok := n.ports[name]
+
+	return t, ok
+}
+
+// MemAddr is the address of a MemTransport.
+type MemAddr string
+
+func (a MemAddr) Network() string { return "mem" }
+func (a MemAddr) String() string  { return string(a) }
+
+type memPacket struct {
+	data []byte
+	from net.Addr
+}
+
+// MemTransport is an in-memory Transport. Like UDP, datagrams to an
+// unknown or full destination are silently dropped.
+type MemTransport struct {
+	network   *MemNetwork
+	addr      MemAddr
+	inbox     chan memPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (t *MemTransport) Addr() net.Addr {
+	return t.addr
+}
+
+func (t *MemTransport) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case packet := <-t.inbox:
+		return copy(p, packet.data), packet.from, nil
+	case <-t.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (t *MemTransport) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-t.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	dest, ok := t.network.lookup(addr.String())
+	if !ok {
+		return len(p), nil
+	}
+
+	packet := memPacket{data: append([]byte(nil), p...), from: t.addr}
+
+	select {
+	case dest.inbox <- packet:
+	default:
+	}
+
+	return len(p), nil
+}
+
+func (t *MemTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+
+		t.network.mu.Lock()
+		delete(t.network.ports, string(t.addr))
+		t.network.mu.Unlock()
+	})
+
+	return nil
+}
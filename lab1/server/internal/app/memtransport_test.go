@@ -0,0 +1,278 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+type params = map[string]interface{}
+
+// testServer is a Service serving on an in-memory network, so tests do
+// no real network I/O.
+type testServer struct {
+	*Service
+	network *MemNetwork
+	conn    *MemTransport
+	clients atomic.Int64
+}
+
+// newTestServer starts serving a Service built from cfg. The server
+// stops when the test ends.
+func newTestServer(t *testing.T, cfg *config.Config) *testServer {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+
+	service, err := NewService(cfg)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	network := NewMemNetwork()
+	conn, err := network.Listen("server")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+
+	go service.Serve(conn)
+	t.Cleanup(func() { conn.Close() })
+
+	return &testServer{Service: service, network: network, conn: conn}
+}
+
+// listen binds a fresh client-side transport on the server's network.
+func (ts *testServer) listen(t *testing.T) *MemTransport {
+	t.Helper()
+
+	conn, err := ts.network.Listen(fmt.Sprintf("client-%d", ts.clients.Add(1)))
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// client returns a client on its own socket that does not retry.
+func (ts *testServer) client(t *testing.T) *RPCClient {
+	t.Helper()
+
+	cc := NewClientConn(ts.listen(t))
+	t.Cleanup(func() { cc.Close() })
+
+	return cc.NewClientAddr(ts.conn.Addr(), time.Second, 0)
+}
+
+// call makes a call that must get a response.
+func (ts *testServer) call(t *testing.T, method string, params map[string]interface{}) *RPCResponse {
+	t.Helper()
+
+	resp, err := ts.client(t).Call(method, params)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+
+	return resp
+}
+
+// exchange sends one raw datagram from conn and returns the datagram
+// that comes back, or false if none does within timeout.
+func (ts *testServer) exchange(t *testing.T, conn *MemTransport, data []byte, timeout time.Duration) ([]byte, bool) {
+	t.Helper()
+
+	if _, err := conn.WriteTo(data, ts.conn.Addr()); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	return receive(conn, timeout)
+}
+
+// fakeServer reads requests on its own transport and answers each with
+// the responses reply returns for it, so tests can script replies the
+// real server would not send.
+type fakeServer struct {
+	conn *MemTransport
+
+	mu       sync.Mutex
+	requests []RPCRequest
+}
+
+func newFakeServer(t *testing.T, ts *testServer, reply func(req *RPCRequest) []*RPCResponse) *fakeServer {
+	t.Helper()
+
+	f := &fakeServer{conn: ts.listen(t)}
+
+	go func() {
+		buffer := make([]byte, 64<<10)
+		for {
+			n, addr, err := f.conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+
+			var req RPCRequest
+			if err := json.Unmarshal(buffer[:n], &req); err != nil {
+				continue
+			}
+
+			f.mu.Lock()
+			f.requests = append(f.requests, req)
+			f.mu.Unlock()
+
+			for _, resp := range reply(&req) {
+				data, _ := json.Marshal(resp)
+				f.conn.WriteTo(data, addr)
+			}
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeServer) received() []RPCRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]RPCRequest(nil), f.requests...)
+}
+
+// clientFor returns a client of server at addr on a fresh socket.
+func (ts *testServer) clientFor(t *testing.T, addr net.Addr, timeout time.Duration, maxRetries int) *RPCClient {
+	t.Helper()
+
+	cc := NewClientConn(ts.listen(t))
+	t.Cleanup(func() { cc.Close() })
+
+	client := cc.NewClientAddr(addr, timeout, maxRetries)
+	client.Backoff = time.Millisecond
+
+	return client
+}
+
+// rawRequest encodes a request with a fixed RequestID.
+func rawRequest(t *testing.T, requestID, method string, params map[string]interface{}) []byte {
+	t.Helper()
+
+	return mustMarshal(t, RPCRequest{RequestID: requestID, Method: method, Params: params})
+}
+
+// receive reads one datagram from conn, giving up after timeout.
+func receive(conn *MemTransport, timeout time.Duration) ([]byte, bool) {
+	select {
+	case packet := <-conn.inbox:
+		return packet.data, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+// decodeResponse unmarshals a raw response datagram.
+func decodeResponse(t *testing.T, data []byte) *RPCResponse {
+	t.Helper()
+
+	var resp RPCResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("decoding response %s: %v", data, err)
+	}
+
+	return &resp
+}
+
+// jsonEqual compares two values as JSON, so expectations can be written
+// with ints while results hold float64s.
+func jsonEqual(t *testing.T, got, want interface{}) bool {
+	t.Helper()
+
+	return reflect.DeepEqual(normalizeJSON(t, got), normalizeJSON(t, want))
+}
+
+func normalizeJSON(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+
+	var normalized interface{}
+	data := mustMarshal(t, v)
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		t.Fatalf("unmarshaling %s: %v", data, err)
+	}
+
+	return normalized
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshaling %v: %v", v, err)
+	}
+
+	return data
+}
+
+func TestMemTransport(t *testing.T) {
+	network := NewMemNetwork()
+
+	a, err := network.Listen("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := network.Listen("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := network.Listen("a"); err == nil {
+		t.Error("second Listen on the same name succeeded")
+	}
+
+	if _, err := a.WriteTo([]byte("ping"), b.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := make([]byte, 16)
+	n, from, err := b.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buffer[:n]) != "ping" || from.String() != "a" {
+		t.Errorf("got %q from %v, want \"ping\" from a", buffer[:n], from)
+	}
+
+	// Like UDP, sending to nobody is not an error.
+	if _, err := a.WriteTo([]byte("lost"), MemAddr("nobody")); err != nil {
+		t.Errorf("WriteTo unknown address: %v", err)
+	}
+
+	b.Close()
+	if _, _, err := b.ReadFrom(buffer); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("ReadFrom after Close: %v, want net.ErrClosed", err)
+	}
+	if _, err := b.WriteTo([]byte("x"), a.Addr()); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("WriteTo after Close: %v, want net.ErrClosed", err)
+	}
+
+	// The name is free again once closed.
+	if _, err := network.Listen("b"); err != nil {
+		t.Errorf("Listen after Close: %v", err)
+	}
+}
+
+func TestMemTransportRoundTrip(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	resp := ts.call(t, "add", map[string]interface{}{"a": 5, "b": 7})
+	if resp.Status != "OK" || resp.Result != 12.0 {
+		t.Errorf("add 5 7 = %v (%s), want 12", resp.Result, resp.Status)
+	}
+}
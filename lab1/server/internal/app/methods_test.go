@@ -0,0 +1,177 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+// methodTests drives each method through a client and server on an
+// in-memory network. Cases with an empty status expect OK and want as
+// the result; the others expect that status and an error containing
+// errContains.
+var methodTests = []struct {
+	name        string
+	method      string
+	params      params
+	want        interface{}
+	status      string
+	errContains string
+}{
+	{name: "add", method: "add", params: params{"a": 5, "b": 7}, want: 12},
+	{name: "subtract", method: "subtract", params: params{"a": 10, "b": 3}, want: 7},
+	{name: "multiply", method: "multiply", params: params{"a": 6, "b": 7}, want: 42},
+	{name: "divide", method: "divide", params: params{"a": 20, "b": 4}, want: 5},
+	{name: "divide integer", method: "divide", params: params{"a": 17, "b": 5, "integer_division": true}, want: 3},
+	{name: "divide integer negative", method: "divide", params: params{"a": -17, "b": 5, "integer_division": true}, want: -3},
+	{name: "divide integer fraction", method: "divide", params: params{"a": 1.5, "b": 5, "integer_division": true}, status: "ERROR", errContains: "'a'"},
+	{name: "divide by zero", method: "divide", params: params{"a": 1, "b": 0}, status: "ERROR", errContains: "division by zero"},
+	{name: "reverse_string", method: "reverse_string", params: params{"s": "héllo"}, want: "olléh"},
+	{name: "echo", method: "echo", params: params{"x": "y", "n": 1}, want: params{"x": "y", "n": 1}},
+	{name: "eval", method: "eval", params: params{"expr": "3 + 4 * 2"}, want: 11},
+	{name: "eval parens", method: "eval", params: params{"expr": "(3 + 4) * 2"}, want: 14},
+	{name: "eval invalid", method: "eval", params: params{"expr": "3 +"}, status: "ERROR"},
+	{name: "bit_and", method: "bit_and", params: params{"a": 12, "b": 10}, want: 8},
+	{name: "bit_or", method: "bit_or", params: params{"a": 12, "b": 10}, want: 14},
+	{name: "bit_xor", method: "bit_xor", params: params{"a": 12, "b": 10}, want: 6},
+	{name: "shift_left", method: "shift_left", params: params{"a": 1, "bits": 4}, want: 16},
+	{name: "shift_right", method: "shift_right", params: params{"a": -16, "bits": 2}, want: -4},
+	{name: "format_number", method: "format_number", params: params{"value": 1234567.891}, want: "1,234,567.89"},
+	{name: "format_number separators", method: "format_number", params: params{"value": 1234567.891, "decimals": 1, "thousands_sep": ".", "decimal_sep": ","}, want: "1.234.567,9"},
+	{name: "format_number negative", method: "format_number", params: params{"value": -1234567.891}, want: "-1,234,567.89"},
+	{name: "format_number zero decimals", method: "format_number", params: params{"value": 1234.6, "decimals": 0}, want: "1,235"},
+	{name: "format_number negative zero", method: "format_number", params: params{"value": -0.001}, want: "0.00"},
+	{name: "repeat", method: "repeat", params: params{"s": "ab", "count": 3}, want: "ababab"},
+	{name: "factorize", method: "factorize", params: params{"n": 24}, want: []int{2, 2, 2, 3}},
+	{name: "factorize grouped", method: "factorize", params: params{"n": 24, "grouped": true}, want: params{"2": 3, "3": 1}},
+	{name: "factorize big", method: "factorize", params: params{"n": "18446744073709551617"}, want: []int{274177, 67280421310721}},
+	{name: "factorize zero", method: "factorize", params: params{"n": 0}, status: "ERROR", errContains: "positive"},
+	{name: "count_occurrences", method: "count_occurrences", params: params{"s": "aaaa", "substr": "aa"}, want: 2},
+	{name: "count_occurrences overlapping", method: "count_occurrences", params: params{"s": "aaaa", "substr": "aa", "overlapping": true}, want: 3},
+	{name: "count_occurrences empty substr", method: "count_occurrences", params: params{"s": "abc", "substr": ""}, status: "ERROR", errContains: "must not be empty"},
+	{name: "is_palindrome", method: "is_palindrome", params: params{"s": "Never odd or even", "ignore_case": true, "ignore_spaces": true}, want: true},
+	{name: "is_palindrome case", method: "is_palindrome", params: params{"s": "Abba"}, want: false},
+	{name: "json_path", method: "json_path", params: params{"data": params{"a": params{"b": []interface{}{params{"c": 1}}}}, "path": "a.b[0].c"}, want: 1},
+	{name: "json_path array", method: "json_path", params: params{"data": []interface{}{params{"id": 7}}, "path": "[0].id"}, want: 7},
+	{name: "json_path missing", method: "json_path", params: params{"data": params{"a": 1}, "path": "b"}, status: "ERROR"},
+	{name: "regex_match groups", method: "regex_match", params: params{"s": "id=42", "pattern": `id=(\d+)`, "groups": true}, want: params{"matched": true, "match": "id=42", "groups": []string{"42"}}},
+	{name: "regex_match", method: "regex_match", params: params{"s": "abc", "pattern": `^\d+$`}, want: params{"matched": false}},
+	{name: "checksum", method: "checksum", params: params{"data": "AAEC/w==", "algo": "md5"}, want: "0416dab819887333af831f8c765ac2ae"},
+	{name: "checksum bad base64", method: "checksum", params: params{"data": "!!", "algo": "md5"}, status: "ERROR"},
+	{name: "truncate", method: "truncate", params: params{"s": "héllo wörld", "max_len": 8}, want: "héllo..."},
+	{name: "truncate short", method: "truncate", params: params{"s": "hi", "max_len": 8}, want: "hi"},
+	{name: "number_to_words", method: "number_to_words", params: params{"value": 1234}, want: "one thousand two hundred thirty-four"},
+	{name: "number_to_words negative", method: "number_to_words", params: params{"value": -7}, want: "minus seven"},
+	{name: "distance", method: "distance", params: params{"p1": []int{0, 0}, "p2": []int{3, 4}}, want: 5},
+	{name: "distance manhattan", method: "distance", params: params{"p1": []int{1, 2, 3}, "p2": []int{4, 0, 3}, "metric": "manhattan"}, want: 5},
+	{name: "distance dimensions", method: "distance", params: params{"p1": []int{1}, "p2": []int{1, 2}}, status: "ERROR"},
+	{name: "fibonacci", method: "fibonacci", params: params{"n": 10}, want: 55},
+	{name: "fibonacci big", method: "fibonacci", params: params{"n": 100}, want: "354224848179261915075"},
+	{name: "histogram", method: "histogram", params: params{"values": []int{1, 2, 2, 3, 3, 3, 4, 4, 4, 4}, "bins": 4}, want: params{"edges": []float64{1, 1.75, 2.5, 3.25, 4}, "counts": []int{1, 2, 3, 4}}},
+	{name: "to_base", method: "to_base", params: params{"value": 255, "base": 36}, want: "73"},
+	{name: "to_binary", method: "to_binary", params: params{"value": -5}, want: "-101"},
+	{name: "to_hex", method: "to_hex", params: params{"value": 255}, want: "ff"},
+	{name: "to_base binary", method: "to_base", params: params{"value": 5, "base": 2}, want: "101"},
+	{name: "to_base below 2", method: "to_base", params: params{"value": 5, "base": 1}, status: "ERROR", errContains: "between 2 and 36"},
+	{name: "to_base above 36", method: "to_base", params: params{"value": 5, "base": 37}, status: "ERROR", errContains: "between 2 and 36"},
+	{name: "sort", method: "sort", params: params{"values": []int{5, 2, 8, 1, 9}}, want: []int{1, 2, 5, 8, 9}},
+	{name: "sort strings desc", method: "sort", params: params{"values": []string{"apple", "pear"}, "desc": true}, want: []string{"pear", "apple"}},
+	{name: "sort mixed", method: "sort", params: params{"values": []interface{}{1, "a"}}, status: "ERROR"},
+	{name: "moving_average", method: "moving_average", params: params{"values": []int{1, 2, 3, 4, 5}, "window": 2}, want: []float64{1.5, 2.5, 3.5, 4.5}},
+	{name: "levenshtein", method: "levenshtein", params: params{"a": "kitten", "b": "sitting"}, want: 3},
+	{name: "levenshtein normalized", method: "levenshtein", params: params{"a": "kitten", "b": "sitting", "normalized": true}, want: 0.5714285714285714},
+	{name: "levenshtein unicode", method: "levenshtein", params: params{"a": "café", "b": "cafe"}, want: 1},
+	{name: "levenshtein unicode normalized", method: "levenshtein", params: params{"a": "naïve", "b": "naive", "normalized": true}, want: 0.8},
+	{name: "levenshtein too long", method: "levenshtein", params: params{"a": strings.Repeat("a", 5000), "b": strings.Repeat("b", 5000)}, status: "ERROR", errContains: "inputs too long"},
+	{name: "set_op union", method: "set_op", params: params{"a": []int{3, 1, 2}, "b": []int{2, 4}, "op": "union"}, want: []int{3, 1, 2, 4}},
+	{name: "set_op intersection", method: "set_op", params: params{"a": []int{3, 1, 2}, "b": []int{2, 4}, "op": "intersection"}, want: []int{2}},
+	{name: "set_op difference", method: "set_op", params: params{"a": []int{3, 1, 2}, "b": []int{2, 4}, "op": "difference"}, want: []int{3, 1}},
+	{name: "weighted_average", method: "weighted_average", params: params{"values": []int{80, 90}, "weights": []int{1, 3}}, want: 87.5},
+	{name: "weighted_average zero weights", method: "weighted_average", params: params{"values": []int{80, 90}, "weights": []int{0, 0}}, status: "ERROR"},
+	{name: "heat_index", method: "heat_index", params: params{"temp_f": 100, "humidity": 60}, want: 129.5},
+	{name: "json_merge", method: "json_merge", params: params{"a": params{"x": params{"y": 1}, "tags": []string{"a"}}, "b": params{"x": params{"z": 2}, "tags": []string{"b"}}, "array_strategy": "concat"}, want: params{"x": params{"y": 1, "z": 2}, "tags": []string{"a", "b"}}},
+	{name: "json_merge replace", method: "json_merge", params: params{"a": params{"tags": []string{"a"}}, "b": params{"tags": []string{"b"}}}, want: params{"tags": []string{"b"}}},
+	{name: "base_convert", method: "base_convert", params: params{"value": "ff", "from_base": 16, "to_base": 2}, want: "11111111"},
+	{name: "base_convert negative", method: "base_convert", params: params{"value": "-FF", "from_base": 16, "to_base": 10}, want: "-255"},
+	{name: "percentile", method: "percentile", params: params{"values": []int{15, 20, 35, 40, 50}, "p": 40}, want: 29},
+	{name: "percentile p0", method: "percentile", params: params{"values": []int{35, 15, 50, 20, 40}, "p": 0}, want: 15},
+	{name: "percentile p50", method: "percentile", params: params{"values": []int{35, 15, 50, 20, 40}, "p": 50}, want: 35},
+	{name: "percentile p100", method: "percentile", params: params{"values": []int{35, 15, 50, 20, 40}, "p": 100}, want: 50},
+	{name: "percentile out of range", method: "percentile", params: params{"values": []int{1, 2}, "p": 101}, status: "ERROR", errContains: "between 0 and 100"},
+	{name: "round_half_even", method: "round_half_even", params: params{"value": 2.5}, want: 2},
+	{name: "round_half_even decimals", method: "round_half_even", params: params{"value": 2.675, "decimals": 2}, want: 2.68},
+	{name: "matrix_multiply", method: "matrix_multiply", params: params{"a": [][]int{{1, 2}, {3, 4}}, "b": [][]int{{5, 6}, {7, 8}}}, want: [][]int{{19, 22}, {43, 50}}},
+	{name: "matrix_multiply shapes", method: "matrix_multiply", params: params{"a": [][]int{{1, 2}}, "b": [][]int{{1, 2}}}, status: "ERROR"},
+	{name: "top_n", method: "top_n", params: params{"values": []int{5, 1, 9, 3, 7}, "n": 3}, want: []int{9, 7, 5}},
+	{name: "top_n smallest", method: "top_n", params: params{"values": []int{5, 1, 9, 3, 7}, "n": 2, "largest": false}, want: []int{1, 3}},
+	{name: "url_encode", method: "url_encode", params: params{"s": "a b&c"}, want: "a+b%26c"},
+	{name: "url_encode path", method: "url_encode", params: params{"s": "a b", "path": true}, want: "a%20b"},
+	{name: "url_decode", method: "url_decode", params: params{"s": "a+b%26c"}, want: "a b&c"},
+	{name: "url_decode malformed", method: "url_decode", params: params{"s": "%zz"}, status: "ERROR"},
+	{name: "is_prime", method: "is_prime", params: params{"n": 97}, want: true},
+	{name: "is_prime composite", method: "is_prime", params: params{"n": 91}, want: false},
+	{name: "next_prime", method: "next_prime", params: params{"n": 14}, want: 17},
+	{name: "is_prime large", method: "is_prime", params: params{"n": 9007199254740881}, want: true},
+	{name: "is_prime large composite", method: "is_prime", params: params{"n": 9007199254740879}, want: false},
+	{name: "next_prime large", method: "next_prime", params: params{"n": 9007199254740880}, want: 9007199254740881},
+	{name: "zip", method: "zip", params: params{"arrays": []interface{}{[]int{1, 2, 3}, []string{"a", "b", "c"}}}, want: []interface{}{[]interface{}{1, "a"}, []interface{}{2, "b"}, []interface{}{3, "c"}}},
+	{name: "zip unequal", method: "zip", params: params{"arrays": []interface{}{[]int{1, 2}, []int{1}}}, status: "ERROR"},
+	{name: "unzip", method: "unzip", params: params{"tuples": []interface{}{[]interface{}{1, "a"}, []interface{}{2, "b"}}}, want: []interface{}{[]int{1, 2}, []string{"a", "b"}}},
+	{name: "csv_parse", method: "csv_parse", params: params{"data": "name,age\nann,31\n\"lee, jr\",42", "has_header": true}, want: params{"header": []string{"name", "age"}, "rows": []params{{"name": "ann", "age": "31"}, {"name": "lee, jr", "age": "42"}}}},
+	{name: "csv_parse delimiter", method: "csv_parse", params: params{"data": "a;b\n1;\"2;3\"", "delimiter": ";"}, want: params{"rows": [][]string{{"a", "b"}, {"1", "2;3"}}}},
+	{name: "csv_parse unterminated quote", method: "csv_parse", params: params{"data": "a,\"b\n1,2"}, status: "ERROR", errContains: "not valid CSV"},
+	{name: "csv_parse ragged", method: "csv_parse", params: params{"data": "a,b\n1"}, status: "ERROR", errContains: "not valid CSV"},
+	{name: "date_parse", method: "date_parse", params: params{"value": "29/02/2024 12:00", "layout": "%d/%m/%Y %H:%M"}, want: 1709208000},
+	{name: "date_format", method: "date_format", params: params{"timestamp": 1709208000, "layout": "RFC3339", "timezone": "Asia/Tokyo"}, want: "2024-02-29T21:00:00+09:00"},
+	{name: "date_parse invalid date", method: "date_parse", params: params{"value": "31/02/2024 12:00", "layout": "%d/%m/%Y %H:%M"}, status: "ERROR", errContains: "cannot parse"},
+	{name: "date_parse layout mismatch", method: "date_parse", params: params{"value": "2024-02-29", "layout": "%d/%m/%Y"}, status: "ERROR", errContains: "cannot parse"},
+	{name: "flatten", method: "flatten", params: params{"values": []interface{}{1, []interface{}{2, []interface{}{3}}}}, want: []interface{}{1, 2, []int{3}}},
+	{name: "flatten deep", method: "flatten", params: params{"values": []interface{}{1, []interface{}{2, []interface{}{3, []int{4}}}}, "deep": true}, want: []int{1, 2, 3, 4}},
+	{name: "chunk", method: "chunk", params: params{"values": []int{1, 2, 3, 4, 5}, "size": 2}, want: [][]int{{1, 2}, {3, 4}, {5}}},
+	{name: "geo_distance", method: "geo_distance", params: params{"lat1": 51.5074, "lon1": -0.1278, "lat2": 48.8566, "lon2": 2.3522}, want: 343.55653488088257},
+	{name: "geo_distance latitude", method: "geo_distance", params: params{"lat1": 91, "lon1": 0, "lat2": 0, "lon2": 0}, status: "ERROR"},
+	{name: "to_roman", method: "to_roman", params: params{"value": 1994}, want: "MCMXCIV"},
+	{name: "from_roman", method: "from_roman", params: params{"numeral": "mcmxciv"}, want: 1994},
+	{name: "from_roman non-standard", method: "from_roman", params: params{"numeral": "IIII"}, status: "ERROR"},
+	{name: "dedupe", method: "dedupe", params: params{"values": []int{3, 1, 3, 2, 1}}, want: []int{3, 1, 2}},
+	{name: "dedupe sorted", method: "dedupe", params: params{"values": []int{3, 1, 3, 2, 1}, "sorted": true}, want: []int{1, 2, 3}},
+	{name: "dedupe mixed types", method: "dedupe", params: params{"values": []interface{}{1, "1"}}, status: "ERROR", errContains: "only numbers or only strings"},
+	{name: "text_stats", method: "text_stats", params: params{"s": "Hello world. How are you?"}, want: params{"chars": 25, "words": 5, "sentences": 2, "avg_word_length": 3.8}},
+	{name: "text_stats unicode", method: "text_stats", params: params{"s": "Привет, мир! Ça va?"}, want: params{"chars": 19, "words": 4, "sentences": 2, "avg_word_length": 3.25}},
+	{name: "transform_array map", method: "transform_array", params: params{"values": []int{-2, 1, 3}, "op": "map", "fn": "square"}, want: []int{4, 1, 9}},
+	{name: "transform_array filter", method: "transform_array", params: params{"values": []int{-2, 1, 3}, "op": "filter", "fn": "positive"}, want: []int{1, 3}},
+	{name: "transform_array reduce", method: "transform_array", params: params{"values": []int{-2, 1, 3}, "op": "reduce", "fn": "sum"}, want: 2},
+	{name: "transform_array map empty", method: "transform_array", params: params{"values": []int{}, "op": "map", "fn": "square"}, want: []int{}},
+	{name: "transform_array filter empty", method: "transform_array", params: params{"values": []int{}, "op": "filter", "fn": "positive"}, want: []int{}},
+	{name: "transform_array reduce empty", method: "transform_array", params: params{"values": []int{}, "op": "reduce", "fn": "sum"}, status: "ERROR", errContains: "must not be empty for reduce"},
+	{name: "transform_array not an array", method: "transform_array", params: params{"values": 3, "op": "map", "fn": "square"}, status: "ERROR", errContains: "must be an array of numbers"},
+	{name: "transform_array unknown fn", method: "transform_array", params: params{"values": []int{1}, "op": "map", "fn": "exec"}, status: "ERROR", errContains: "'fn' must be one of"},
+	{name: "unknown method", method: "ad", params: params{}, status: "ERROR", errContains: "add"},
+	{name: "wrong param type", method: "add", params: params{"a": "5", "b": 7}, status: "ERROR"},
+}
+
+func TestMethods(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	for _, tt := range methodTests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.call(t, tt.method, tt.params)
+
+			if tt.status == "" {
+				if resp.Status != "OK" {
+					t.Fatalf("status %s (%s), want OK", resp.Status, resp.Error)
+				}
+				if !jsonEqual(t, resp.Result, tt.want) {
+					t.Errorf("result %s, want %s", mustMarshal(t, resp.Result), mustMarshal(t, tt.want))
+				}
+				return
+			}
+
+			if resp.Status != tt.status {
+				t.Fatalf("status %s (result %v), want %s", resp.Status, resp.Result, tt.status)
+			}
+			if !strings.Contains(resp.Error, tt.errContains) {
+				t.Errorf("error %q does not mention %q", resp.Error, tt.errContains)
+			}
+		})
+	}
+}
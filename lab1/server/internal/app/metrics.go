@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metrics counts requests for the /metrics endpoint.
+type metrics struct {
+	requests atomic.Int64
+
+	mu       sync.Mutex
+	statuses map[string]int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{statuses: make(map[string]int64)}
+}
+
+func (m *metrics) record(status string) {
+	m.requests.Add(1)
+
+	m.mu.Lock()
+	m.statuses[status]++
+	m.mu.Unlock()
+}
+
+// ServeHTTP writes the counters in the Prometheus text format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# TYPE rpc_requests_total counter")
+	fmt.Fprintf(w, "rpc_requests_total %d\n", m.requests.Load())
+
+	m.mu.Lock()
+	statuses := make([]string, 0, len(m.statuses))
+	for status := range m.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	fmt.Fprintln(w, "# TYPE rpc_responses_total counter")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "rpc_responses_total{status=%q} %d\n", status, m.statuses[status])
+	}
+	m.mu.Unlock()
+}
+
+// startMetricsServer serves the metrics and health endpoints on addr. The listener is
+// bound before returning so callers learn about a taken port right away.
+func (s *Service) startMetricsServer(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics)
+	mux.HandleFunc("/ready", s.serveReady)
+	mux.HandleFunc("/healthz", s.serveHealthz)
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(ln)
+
+	return server, nil
+}
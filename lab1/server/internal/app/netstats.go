@@ -0,0 +1,57 @@
+package app
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// netStats counts datagram traffic since startup for the net_stats
+// method.
+type netStats struct {
+	packetsReceived atomic.Int64
+	packetsSent     atomic.Int64
+	bytesReceived   atomic.Int64
+	bytesSent       atomic.Int64
+	readErrors      atomic.Int64
+	writeErrors     atomic.Int64
+	parseErrors     atomic.Int64
+	emptyPackets    atomic.Int64
+	deniedPackets   atomic.Int64
+
+	// lastPacket is when the last datagram arrived, in Unix nanoseconds.
+	lastPacket atomic.Int64
+}
+
+func (n *netStats) received(bytes int) {
+	n.packetsReceived.Add(1)
+	n.bytesReceived.Add(int64(bytes))
+	n.lastPacket.Store(time.Now().UnixNano())
+}
+
+// send writes a server datagram and counts it.
+func (s *Service) send(conn Transport, data []byte, addr net.Addr) error {
+	if err := writePacket(conn, data, addr); err != nil {
+		s.traffic.writeErrors.Add(1)
+		return err
+	}
+
+	s.traffic.packetsSent.Add(1)
+	s.traffic.bytesSent.Add(int64(len(data)))
+
+	return nil
+}
+
+func (s *Service) netStats(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	return map[string]interface{}{
+		"packets_received": s.traffic.packetsReceived.Load(),
+		"packets_sent":     s.traffic.packetsSent.Load(),
+		"bytes_received":   s.traffic.bytesReceived.Load(),
+		"bytes_sent":       s.traffic.bytesSent.Load(),
+		"read_errors":      s.traffic.readErrors.Load(),
+		"write_errors":     s.traffic.writeErrors.Load(),
+		"parse_errors":     s.traffic.parseErrors.Load(),
+		"empty_packets":    s.traffic.emptyPackets.Load(),
+		"denied_packets":   s.traffic.deniedPackets.Load(),
+	}, nil
+}
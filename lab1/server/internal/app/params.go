@@ -0,0 +1,134 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxExactInteger, 2^53, is the largest integer a JSON number holds
+// exactly: clients decode numbers as float64.
+const maxExactInteger = 1 << 53
+
+// getFloat reads a number. With LenientNumbers enabled it also accepts a
+// numeric string such as "5", since some clients quote their numbers.
+func (s *Service) getFloat(raw interface{}) (float64, bool) {
+	switch value := raw.(type) {
+	case float64:
+		return value, true
+	case string:
+		if !s.cfg.LenientNumbers {
+			return 0, false
+		}
+
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return 0, false
+		}
+
+		return parsed, true
+	default:
+		return 0, false
+	}
+}
+
+// getOperands reads the 'a' and 'b' params of the arithmetic methods.
+func (s *Service) getOperands(params map[string]interface{}) (float64, float64, error) {
+	a, ok1 := s.getFloat(params["a"])
+	b, ok2 := s.getFloat(params["b"])
+
+	if !ok1 || !ok2 {
+		return 0, 0, fmt.Errorf("parameters 'a' and 'b' must be numbers")
+	}
+
+	return a, b, nil
+}
+
+// getInt reads a whole-number parameter. JSON numbers always decode as
+// float64, so fractional values are rejected explicitly.
+func getInt(params map[string]interface{}, name string) (int64, error) {
+	value, ok := params[name].(float64)
+	if !ok {
+		return 0, fmt.Errorf("parameter '%s' must be a number", name)
+	}
+
+	return wholeNumber(name, value)
+}
+
+// wholeNumber converts the already read number parameter name to an
+// integer, rejecting fractions and values too large to be exact.
+func wholeNumber(name string, value float64) (int64, error) {
+	if value != math.Trunc(value) || math.Abs(value) > maxExactInteger {
+		return 0, fmt.Errorf("parameter '%s' must be a whole number", name)
+	}
+
+	return int64(value), nil
+}
+
+// getOptionalInt is getInt for a parameter that may be omitted.
+func getOptionalInt(params map[string]interface{}, name string, def int64) (int64, error) {
+	if _, ok := params[name]; !ok {
+		return def, nil
+	}
+
+	return getInt(params, name)
+}
+
+// getOptionalString reads a string parameter that may be omitted.
+func getOptionalString(params map[string]interface{}, name string, def string) (string, error) {
+	raw, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+
+	value, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("parameter '%s' must be a string", name)
+	}
+
+	return value, nil
+}
+
+// getOptionalBool reads a boolean parameter that may be omitted.
+func getOptionalBool(params map[string]interface{}, name string, def bool) (bool, error) {
+	raw, ok := params[name]
+	if !ok {
+		return def, nil
+	}
+
+	value, ok := raw.(bool)
+	if !ok {
+		return false, fmt.Errorf("parameter '%s' must be a boolean", name)
+	}
+
+	return value, nil
+}
+
+// getNumbers reads a non-empty array of numbers.
+func (s *Service) getNumbers(params map[string]interface{}, name string) ([]float64, error) {
+	if raw, ok := params[name].([]interface{}); !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("parameter '%s' must be a non-empty array of numbers", name)
+	}
+
+	return s.getNumberArray(params, name)
+}
+
+// getNumberArray reads an array of numbers, which may be empty.
+func (s *Service) getNumberArray(params map[string]interface{}, name string) ([]float64, error) {
+	raw, ok := params[name].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter '%s' must be an array of numbers", name)
+	}
+
+	point := make([]float64, len(raw))
+	for i, elem := range raw {
+		value, ok := s.getFloat(elem)
+		if !ok {
+			return nil, fmt.Errorf("parameter '%s' element %d must be a number", name, i)
+		}
+		point[i] = value
+	}
+
+	return point, nil
+}
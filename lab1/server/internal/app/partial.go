@@ -0,0 +1,20 @@
+package app
+
+import "time"
+
+// partialGrace is how long a timed-out call to a method in
+// partialMethods is given to hand back what it has.
+const partialGrace = 50 * time.Millisecond
+
+// partialMethods can answer a timed-out call with an incomplete result.
+// They watch the call context and, when it is done and the caller passed
+// allow_partial, return a partialResult promptly.
+var partialMethods = map[string]bool{
+	"factorize": true,
+}
+
+// partialResult wraps the result of a method cut short by its timeout.
+// It is sent with status OK and partial set.
+type partialResult struct {
+	value interface{}
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+func TestPartialResults(t *testing.T) {
+	// n = 4p for the largest prime p that keeps n exact as a JSON number.
+	// Trial division finds the 2s at once and then runs far past the
+	// timeout looking for a factor of p.
+	p := big.NewInt(maxExactInteger / 4)
+	for !p.ProbablyPrime(20) {
+		p.Sub(p, big.NewInt(1))
+	}
+	n := 4 * p.Int64()
+
+	ts := newTestServer(t, &config.Config{
+		MethodTimeouts: map[string]time.Duration{"factorize": 5 * time.Millisecond},
+	})
+
+	tests := []struct {
+		name    string
+		params  params
+		status  string
+		partial bool
+		want    interface{}
+	}{
+		{
+			name:    "partial factors",
+			params:  params{"n": n, "allow_partial": true},
+			status:  "OK",
+			partial: true,
+			want:    params{"factors": []int{2, 2}, "remaining": p.String()},
+		},
+		{
+			name:    "partial grouped",
+			params:  params{"n": n, "allow_partial": true, "grouped": true},
+			status:  "OK",
+			partial: true,
+			want:    params{"factors": params{"2": 2}, "remaining": p.String()},
+		},
+		{
+			name:   "finished in time",
+			params: params{"n": 24, "allow_partial": true},
+			status: "OK",
+			want:   []int{2, 2, 2, 3},
+		},
+		{
+			name:   "timeout without allow_partial",
+			params: params{"n": n},
+			status: "TIMEOUT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := ts.call(t, "factorize", tt.params)
+			if resp.Status != tt.status || resp.Partial != tt.partial {
+				t.Fatalf("status %s, partial %v (%s); want %s, partial %v", resp.Status, resp.Partial, resp.Error, tt.status, tt.partial)
+			}
+			if tt.want != nil && !jsonEqual(t, resp.Result, tt.want) {
+				t.Errorf("result %s, want %s", mustMarshal(t, resp.Result), mustMarshal(t, tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+// pluginSymbol is the variable a method plugin exports: a map from method
+// name to PluginMethod. For example:
+//
+//	var Methods = map[string]func(context.Context, map[string]interface{}) (interface{}, error){
+//		"shout": shout,
+//	}
+const pluginSymbol = "Methods"
+
+// PluginMethod is a method provided by a plugin. It uses only standard
+// library types, so plugins do not need to import this module; ctx is the
+// request's CallContext.
+type PluginMethod = func(ctx context.Context, params map[string]interface{}) (interface{}, error)
+
+// loadPlugins opens every .so file in dir and registers the methods they
+// export. A plugin that fails to load is logged and skipped, and plugin
+// methods never replace a built-in one.
+func (s *Service) loadPlugins(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		s.logger.Warn("plugins disabled", "dir", dir, "error", err)
+		return
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.so"))
+	for _, path := range paths {
+		methods, err := openPlugin(path)
+		if err != nil {
+			s.logger.Warn("skipping plugin", "path", path, "error", err)
+			continue
+		}
+
+		registered := 0
+		for name, method := range methods {
+			if _, ok := s.methods[name]; ok || method == nil {
+				s.logger.Warn("skipping plugin method", "path", path, "method", name)
+				continue
+			}
+
+			s.methods[name] = func(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+				return method(ctx, params)
+			}
+			registered++
+		}
+
+		s.logger.Info("loaded plugin", "path", path, "methods", registered)
+	}
+}
+
+// openPlugin loads the plugin at path and returns its exported methods.
+func openPlugin(path string) (map[string]PluginMethod, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := p.Lookup(pluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, ok := sym.(*map[string]PluginMethod)
+	if !ok {
+		return nil, fmt.Errorf("symbol %s is a %T, expected *map[string]PluginMethod", pluginSymbol, sym)
+	}
+
+	return *methods, nil
+}
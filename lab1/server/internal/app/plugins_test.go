@@ -0,0 +1,106 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+
+	"server/internal/config"
+)
+
+var (
+	testPluginOnce sync.Once
+	testPluginPath string
+	testPluginErr  error
+)
+
+// buildTestPlugin builds testdata/plugin once per test binary. A process
+// cannot load two copies of one plugin, so repeated runs (-count) must
+// share the file; it is left in the temp dir for that reason.
+func buildTestPlugin(t *testing.T) string {
+	t.Helper()
+
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		t.Skipf("plugins are not supported on %s", runtime.GOOS)
+	}
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to build the plugin with")
+	}
+	if out, err := exec.Command(goTool, "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("plugins need cgo")
+	}
+
+	testPluginOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "app-plugin")
+		if err != nil {
+			testPluginErr = err
+			return
+		}
+		testPluginPath = filepath.Join(dir, "shout.so")
+
+		// The plugin must be built like the test binary, or it will not
+		// load into it.
+		args := []string{"build", "-buildmode=plugin"}
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "-race" && setting.Value == "true" {
+					args = append(args, "-race")
+				}
+			}
+		}
+		args = append(args, "-o", testPluginPath, "./testdata/plugin")
+
+		if out, err := exec.Command(goTool, args...).CombinedOutput(); err != nil {
+			testPluginErr = fmt.Errorf("%v\n%s", err, out)
+		}
+	})
+	if testPluginErr != nil {
+		t.Fatalf("building the test plugin: %v", testPluginErr)
+	}
+
+	return testPluginPath
+}
+
+func TestLoadPlugins(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a plugin")
+	}
+	built := buildTestPlugin(t)
+
+	dir := t.TempDir()
+	if err := os.Symlink(built, filepath.Join(dir, "shout.so")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newTestServer(t, &config.Config{PluginDir: dir})
+
+	if resp := ts.call(t, "shout", params{"s": "hello"}); resp.Status != "OK" || resp.Result != "HELLO" {
+		t.Errorf("shout: %s %v (%s)", resp.Status, resp.Result, resp.Error)
+	}
+	if resp := ts.call(t, "add", params{"a": 1, "b": 2}); resp.Result != 3.0 {
+		t.Errorf("add = %v, want the built-in's 3", resp.Result)
+	}
+
+	for _, want := range [][]string{
+		{"skipping plugin method", "method=add"},
+		{"skipping plugin", "broken.so"},
+		{"loaded plugin", "shout.so", "methods=1"},
+	} {
+		if !ts.logged(want...) {
+			t.Errorf("no log line with %q; log:\n%s", want, strings.Join(ts.logs.tail(logRingSize), "\n"))
+		}
+	}
+}
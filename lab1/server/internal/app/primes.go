@@ -0,0 +1,50 @@
+package app
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// isPrime tests n with math/big's Baillie-PSW check, which is exact for
+// every integer a JSON number can carry (it is proven for n < 2^64).
+func isPrime(n int64) bool {
+	return n > 1 && big.NewInt(n).ProbablyPrime(0)
+}
+
+func (s *Service) isPrimeMethod(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	n, err := getInt(params, "n")
+	if err != nil {
+		return nil, err
+	}
+
+	return isPrime(n), nil
+}
+
+// nextPrime returns the smallest prime greater than n. Prime gaps below
+// 2^53 are under 1000, so the search ends quickly.
+func (s *Service) nextPrime(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	n, err := getInt(params, "n")
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 2 {
+		return int64(2), nil
+	}
+
+	candidate := n + 1
+	if candidate%2 == 0 {
+		candidate++
+	}
+	for !isPrime(candidate) {
+		candidate += 2
+	}
+
+	// Clients decode numbers as float64, which would round a larger
+	// prime to a composite.
+	if candidate > maxExactInteger {
+		return nil, fmt.Errorf("next prime after %d is beyond 2^53", n)
+	}
+
+	return candidate, nil
+}
@@ -0,0 +1,18 @@
+package app
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// generateRequestID returns a random (version 4) UUID. With 122 random
+// bits, collisions are not a practical concern even across many clients.
+func generateRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+// romanSymbols lists numeral values from largest to smallest, including
+// the subtractive pairs, so greedy conversion gives the standard form.
+var romanSymbols = []struct {
+	value  int64
+	symbol string
+}{
+	{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+	{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+	{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+}
+
+// maxRoman is the largest number standard numerals can write.
+const maxRoman = 3999
+
+func toRoman(n int64) string {
+	var b strings.Builder
+	for _, sym := range romanSymbols {
+		for n >= sym.value {
+			b.WriteString(sym.symbol)
+			n -= sym.value
+		}
+	}
+
+	return b.String()
+}
+
+func (s *Service) toRomanMethod(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, err := getInt(params, "value")
+	if err != nil {
+		return nil, err
+	}
+	if value < 1 || value > maxRoman {
+		return nil, fmt.Errorf("parameter 'value' must be between 1 and %d", maxRoman)
+	}
+
+	return toRoman(value), nil
+}
+
+// fromRoman reads a numeral in standard form, case-insensitively.
+// Non-standard spellings such as IIII or IC are rejected: the numeral
+// must be exactly what to_roman would produce for its value.
+func (s *Service) fromRoman(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	raw, ok := params["numeral"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'numeral' must be a string")
+	}
+
+	numeral := strings.ToUpper(raw)
+	rest := numeral
+	value := int64(0)
+	for _, sym := range romanSymbols {
+		for strings.HasPrefix(rest, sym.symbol) {
+			value += sym.value
+			rest = rest[len(sym.symbol):]
+		}
+	}
+
+	if numeral == "" || rest != "" || value > maxRoman || toRoman(value) != numeral {
+		return nil, fmt.Errorf("parameter 'numeral' is not a valid Roman numeral: %q", raw)
+	}
+
+	return value, nil
+}
@@ -3,20 +3,189 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
-	"math/rand"
 	"net"
 	"os"
 	"server/internal/config"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Service struct {
-	requestLog sync.Map
+	cfg        *config.Config
+	requestLog dedupStore
+	dedupKey   dedupKeyFunc
+	methods    map[string]methodFunc
+	audit      *auditLog
+	metrics    *metrics
+
+	// limiter caps total requests per second across all clients.
+	limiter *tokenBucket
+
+	// challenges guards the methods that must prove the source address.
+	challenges *challenger
+
+	// ipFilter admits or refuses sources by IP before dispatch.
+	ipFilter *ipFilter
+
+	encoder ResponseEncoder
+	sampler accessSampler
+	tracer  *tracer
+	uploads *uploadAssembler
+
+	// tails holds the live tail_logs subscriptions.
+	tails *logTails
+
+	traffic netStats
+
+	// logger is where all server logging goes: stderr and logs, the
+	// recent lines kept for log_snapshot. logLevel can be changed at run
+	// time with set_log_level.
+	logger   *slog.Logger
+	logLevel slog.LevelVar
+	logs     *logRing
+
+	state         atomic.Int32
+	inFlight      sync.WaitGroup
+	inFlightCount atomic.Int64
+
+	// runningRequests holds a *runningRequest for each parsed request
+	// being handled.
+	runningRequests sync.Map
+}
+
+type methodFunc func(ctx *CallContext, params map[string]interface{}) (interface{}, error)
+
+func NewService(cfg *config.Config) (*Service, error) {
+	s := &Service{
+		cfg:        cfg,
+		requestLog: newRequestLog(requestLogTTL),
+		metrics:    newMetrics(),
+		uploads:    newUploadAssembler(),
+		tails:      newLogTails(),
+		logs:       newLogRing(),
+	}
+	s.logLevel.Set(cfg.LogLevel)
+	s.logger = slog.New(slog.NewTextHandler(io.MultiWriter(os.Stderr, s.logs), &slog.HandlerOptions{Level: &s.logLevel}))
+
+	if cfg.MaxRequestsPerSecond > 0 {
+		s.limiter = newTokenBucket(max(cfg.MaxRequestsPerSecond, 1), cfg.MaxRequestsPerSecond)
+	}
+
+	s.challenges = newChallenger(cfg.ChallengeMethods)
+
+	filter, err := newIPFilter(cfg.AllowCIDRs, cfg.DenyCIDRs, cfg.IPDefaultPolicy)
+	if err != nil {
+		return nil, err
+	}
+	s.ipFilter = filter
+
+	if cfg.TraceEndpoint != "" {
+		s.tracer = newTracer(cfg.TraceEndpoint, s.logger)
+	}
+
+	dedupKey, err := newDedupKey(cfg.DedupKey)
+	if err != nil {
+		return nil, err
+	}
+	s.dedupKey = dedupKey
+
+	encoder, err := newResponseEncoder(cfg.ResponseEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	s.encoder = encoder
+
+	if cfg.AuditLogPath != "" {
+		audit, err := newAuditLog(cfg.AuditLogPath, cfg.AuditRedactMethods, s.logger)
+		if err != nil {
+			return nil, err
+		}
+		s.audit = audit
+	}
+
+	s.methods = map[string]methodFunc{
+		"add":               s.add,
+		"subtract":          s.subtract,
+		"multiply":          s.multiply,
+		"divide":            s.divide,
+		"get_time":          s.getTime,
+		"reverse_string":    s.reverseString,
+		"echo":              s.echo,
+		"eval":              s.eval,
+		"bit_and":           s.bitAnd,
+		"bit_or":            s.bitOr,
+		"bit_xor":           s.bitXor,
+		"shift_left":        s.shiftLeft,
+		"shift_right":       s.shiftRight,
+		"format_number":     s.formatNumber,
+		"config":            s.configInfo,
+		"repeat":            s.repeat,
+		"factorize":         s.factorize,
+		"count_occurrences": s.countOccurrences,
+		"is_palindrome":     s.isPalindrome,
+		"json_path":         s.jsonPath,
+		"drain":             s.drain,
+		"health":            s.health,
+		"regex_match":       s.regexMatch,
+		"checksum":          s.checksum,
+		"truncate":          s.truncate,
+		"number_to_words":   s.numberToWords,
+		"distance":          s.distance,
+		"fibonacci":         s.fibonacci,
+		"histogram":         s.histogram,
+		"to_base":           s.toBase,
+		"to_binary":         s.toBinary,
+		"to_hex":            s.toHex,
+		"sort":              s.sortValues,
+		"moving_average":    s.movingAverage,
+		"levenshtein":       s.levenshteinMethod,
+		"set_op":            s.setOp,
+		"weighted_average":  s.weightedAverage,
+		"reset_cache":       s.resetCache,
+		"heat_index":        s.heatIndex,
+		"json_merge":        s.jsonMerge,
+		"net_stats":         s.netStats,
+		"base_convert":      s.baseConvert,
+		"log_snapshot":      s.logSnapshot,
+		"tail_logs":         s.tailLogs,
+		"unsubscribe":       s.unsubscribe,
+		"percentile":        s.percentile,
+		"round_half_even":   s.roundHalfEven,
+		"matrix_multiply":   s.matrixMultiply,
+		"top_n":             s.topN,
+		"url_encode":        s.urlEncode,
+		"url_decode":        s.urlDecode,
+		"is_prime":          s.isPrimeMethod,
+		"next_prime":        s.nextPrime,
+		"zip":               s.zipArrays,
+		"unzip":             s.unzipArrays,
+		"csv_parse":         s.csvParse,
+		"date_parse":        s.dateParse,
+		"date_format":       s.dateFormat,
+		"flatten":           s.flatten,
+		"chunk":             s.chunk,
+		"geo_distance":      s.geoDistance,
+		"to_roman":          s.toRomanMethod,
+		"from_roman":        s.fromRoman,
+		"set_log_level":     s.setLogLevel,
+		"dedupe":            s.dedupe,
+		"text_stats":        s.textStats,
+		"capabilities":      s.capabilities,
+		"transform_array":   s.transformArray,
+		"list_methods":      s.listMethods,
+	}
+
+	if cfg.PluginDir != "" {
+		s.loadPlugins(cfg.PluginDir)
+	}
+
+	return s, nil
 }
 
 type RPCRequest struct {
@@ -24,40 +193,333 @@ type RPCRequest struct {
 	Method    string                 `json:"method"`
 	Params    map[string]interface{} `json:"params"`
 	Timestamp int64                  `json:"timestamp,omitempty"`
+
+	// TraceID ties the request to a wider trace. It defaults to the
+	// RequestID when the client does not set one.
+	TraceID string `json:"trace_id,omitempty"`
+
+	// Validate asks the server to check Params against the method's
+	// schema without executing it.
+	Validate bool `json:"validate,omitempty"`
+
+	// Nonce echoes the one from a CHALLENGE response.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 type RPCResponse struct {
 	RequestID string      `json:"request_id"`
 	Result    interface{} `json:"result,omitempty"`
 	Error     string      `json:"error,omitempty"`
+	ErrorData interface{} `json:"error_data,omitempty"`
 	Status    string      `json:"status"`
+
+	// Stream marks one of several datagrams carrying a list result.
+	// Parts are numbered by Seq and the last one has Final set.
+	Stream bool `json:"stream,omitempty"`
+	Seq    int  `json:"seq,omitempty"`
+	Final  bool `json:"final,omitempty"`
+
+	// Nonce is set on a CHALLENGE response. Resending the request with
+	// it proves the client can receive at its source address.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Timestamp is when the server sent the response, in Unix
+	// milliseconds, and ProcessingMs how long it spent on the request.
+	// Subtracting ProcessingMs from the round trip leaves network time.
+	Timestamp    int64 `json:"timestamp,omitempty"`
+	ProcessingMs int64 `json:"processing_ms,omitempty"`
+
+	// RetryAfterMs is set on OVERLOADED responses to how long the client
+	// should wait before retrying.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+
+	// Compressed marks a response whose real content is the gzipped,
+	// base64 encoded response in Payload. RPCClient unpacks it.
+	Compressed bool   `json:"compressed,omitempty"`
+	Payload    string `json:"payload,omitempty"`
+
+	// UploadDigest is the hex SHA-256 of a request that was sent in
+	// chunks, as reassembled by the server.
+	UploadDigest string `json:"upload_digest,omitempty"`
+
+	// Partial marks the result of a call that ran out of time, holding
+	// what the method had computed so far. See allow_partial.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// MethodError lets a method attach structured context to a failure.
+// The Data is sent back to the client in RPCResponse.ErrorData, and a
+// non-empty Status replaces the generic "ERROR" status.
+type MethodError struct {
+	Message string
+	Data    interface{}
+	Status  string
+}
+
+func (e *MethodError) Error() string {
+	return e.Message
+}
+
+// Transport is the packet connection the server and client exchange
+// datagrams over. *net.UDPConn and *net.UnixConn satisfy it, and
+// MemTransport provides an in-memory one for tests.
+type Transport interface {
+	ReadFrom(p []byte) (n int, addr net.Addr, err error)
+	WriteTo(p []byte, addr net.Addr) (n int, err error)
+	Close() error
+}
+
+// readBufferSize is the largest request the server reads.
+const readBufferSize = 1024
+
+// readBuffers recycles Serve's read buffers. A buffer is returned only
+// after its request has been handled, so no two requests ever share one,
+// and only the n bytes just read are used, so it needs no clearing.
+var readBuffers = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, readBufferSize)
+		return &buffer
+	},
+}
+
+// Run serves until ctx is cancelled, then stops reading, waits for
+// in-flight requests to finish and returns. With a ShutdownTimeout it
+// gives up waiting after that long.
+func Run(ctx context.Context, cfg *config.Config) {
+	service, err := NewService(cfg)
+	if err != nil {
+		slog.Error("creating service", "error", err)
+		return
+	}
+
+	service.run(ctx)
 }
 
-func Run(cfg *config.Config) {
+// run is Run for an already built service. It closes the service's audit
+// log and tracer before returning.
+func (s *Service) run(ctx context.Context) {
+	defer s.audit.Close()
+	defer s.tracer.Close()
+
+	// Client code and anything else using slog or the log package ends
+	// up in the same format and in log_snapshot. log.Printf lines are
+	// logged at INFO with the message as msg; slog adds the time, so the
+	// log package's own prefix is turned off.
+	slog.SetDefault(s.logger)
+	log.SetOutput(slog.NewLogLogger(s.logger.Handler(), slog.LevelInfo).Writer())
+	log.SetFlags(0)
+
+	// Metrics are optional: a taken port should not keep the RPC server
+	// from starting.
+	if s.cfg.MetricsAddr != "" {
+		metricsServer, err := s.startMetricsServer(s.cfg.MetricsAddr)
+		if err != nil {
+			s.logger.Warn("metrics server disabled", "addr", s.cfg.MetricsAddr, "error", err)
+		} else {
+			defer metricsServer.Close()
+		}
+	}
+
+	var conns []Transport
+
+	if s.cfg.SocketPath != "" {
+		unixConn, err := listenUnixgram(s.cfg.SocketPath)
+		if err != nil {
+			s.logger.Error("listening unixgram", "path", s.cfg.SocketPath, "error", err)
+			return
+		}
+		defer unixConn.Close()
+		defer os.Remove(s.cfg.SocketPath)
+
+		conns = append(conns, unixConn)
+	}
+
 	udpAddr := &net.UDPAddr{
-		IP:   cfg.GetIpv4Addr(),
-		Port: cfg.Port,
+		IP:   s.cfg.GetIpv4Addr(),
+		Port: s.cfg.Port,
 	}
 
 	conn, err := net.ListenUDP("udp", udpAddr)
 	if err != nil {
-		slog.Error("listening udp", "config", cfg)
+		s.logger.Error("listening udp", "addr", udpAddr, "error", err)
+		return
 	}
 	defer conn.Close()
 
+	conns = append(conns, conn)
+
+	var serving sync.WaitGroup
+	for _, c := range conns {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			s.Serve(c)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-s.idleDone(ctx, s.cfg.IdleTimeout):
+		s.logger.Info("no traffic, stopping", "idle_timeout", s.cfg.IdleTimeout)
+	}
+	s.logger.Info("shutting down", "in_flight", s.inFlightCount.Load())
+
+	s.advanceState(stateShuttingDown)
+	for _, c := range conns {
+		stopReading(c)
+	}
+	s.tails.close()
+
+	done := make(chan struct{})
+	go func() {
+		serving.Wait()
+		s.inFlight.Wait()
+		close(done)
+	}()
+
+	var grace <-chan time.Time
+	if s.cfg.ShutdownTimeout > 0 {
+		grace = time.After(s.cfg.ShutdownTimeout)
+	}
+
+	select {
+	case <-done:
+	case <-grace:
+		// Stuck handlers are abandoned; closing the conns makes any
+		// reply they still attempt fail instead of going out late.
+		s.logger.Warn("shutdown timed out", "in_flight", s.inFlightCount.Load())
+		s.logAbandoned()
+		for _, c := range conns {
+			c.Close()
+		}
+	}
+}
+
+// Serve reads requests from conn until it is closed or the server shuts
+// down, handling each one in its own goroutine.
+func (s *Service) Serve(conn Transport) {
 	for {
-		buffer := make([]byte, 1024)
+		buffer := readBuffers.Get().(*[]byte)
 
-		n, addr, err := conn.ReadFromUDP(buffer)
+		n, addr, err := conn.ReadFrom(*buffer)
 		if err != nil {
-			slog.Error("error reading from udp", "error", err)
+			readBuffers.Put(buffer)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if s.currentState() == stateShuttingDown && isTimeout(err) {
+				return
+			}
+			s.traffic.readErrors.Add(1)
+			s.logger.Error("reading packet", "error", err)
+			continue
+		}
+		s.traffic.received(n)
+
+		// Empty datagrams, typically from port scans, are dropped without
+		// a reply: an error sent back to a spoofable source would make the
+		// server an amplifier.
+		if n == 0 {
+			s.traffic.emptyPackets.Add(1)
+			readBuffers.Put(buffer)
+			continue
+		}
+
+		data := (*buffer)[:n]
+
+		// Denied sources are turned away before anything is decoded, so
+		// they cannot spend rate limit tokens, hold upload slots or draw
+		// error replies.
+		if !s.ipFilter.allowed(addr) {
+			s.refuse(conn, addr, data)
+			readBuffers.Put(buffer)
+			continue
+		}
+
+		if s.limiter != nil && !s.limiter.take() {
+			s.shed(conn, addr, data)
+			readBuffers.Put(buffer)
 			continue
 		}
 
-		go handleMessage(conn, addr, buffer[:n])
+		s.track(func() {
+			defer readBuffers.Put(buffer)
+			s.handleMessage(conn, addr, data)
+		})
 	}
 }
 
+// shed answers a request that arrived over the global rate limit with
+// OVERLOADED without executing it. Decoding errors are ignored: the
+// reply just goes out without a RequestID.
+//
+// A token may have been refilled since take failed, so wait can return
+// zero; the hint is kept at 1ms or more so OVERLOADED always carries one.
+func (s *Service) shed(conn Transport, addr net.Addr, buffer []byte) {
+	var req RPCRequest
+	json.Unmarshal(buffer, &req)
+
+	retryAfter := max(s.limiter.wait(), time.Millisecond)
+	s.reject(conn, addr, &req, "OVERLOADED", "server is over its request rate limit", retryAfter)
+}
+
+// refuse answers a request from a denied source with FORBIDDEN. Only a
+// whole, well-formed request gets a reply; anything else, including
+// request chunks, is dropped without one so the server does not answer
+// junk sent from a spoofed address.
+func (s *Service) refuse(conn Transport, addr net.Addr, buffer []byte) {
+	s.traffic.deniedPackets.Add(1)
+
+	var req RPCRequest
+	if err := json.Unmarshal(buffer, &req); err != nil || req.RequestID == "" || req.Method == "" {
+		return
+	}
+
+	s.reject(conn, addr, &req, "FORBIDDEN", "source address is not allowed", 0)
+}
+
+// reject answers req with a non-OK status without executing it. A
+// positive retryAfter is sent as a hint for when to try again.
+func (s *Service) reject(conn Transport, addr net.Addr, req *RPCRequest, status, message string, retryAfter time.Duration) {
+	s.audit.Record(req, addr, status)
+	s.metrics.record(status)
+
+	resp := RPCResponse{
+		RequestID: req.RequestID,
+		Status:    status,
+		Error:     message,
+	}
+	if retryAfter > 0 {
+		// Round up so the client never comes back a moment too early.
+		resp.RetryAfterMs = int64((retryAfter + time.Millisecond - 1) / time.Millisecond)
+	}
+
+	respData, _ := s.encoder.Encode(&resp)
+	if err := s.send(conn, respData, addr); err != nil {
+		s.logger.Error("sending response", "status", status, "error", err)
+	}
+}
+
+// listenUnixgram binds a Unix datagram socket at path, replacing a stale
+// socket file left behind by a previous run.
+func listenUnixgram(path string) (*net.UnixConn, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+}
+
+// addrString formats a peer address. Unix datagram peers that did not
+// bind a socket path have no address.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return "unbound"
+	}
+
+	return addr.String()
+}
+
 func (s *Service) ParseInput(buffer []byte) (*RPCRequest, error) {
 	var req RPCRequest
 	if err := json.Unmarshal(buffer, &req); err != nil {
@@ -76,20 +538,68 @@ func (s *Service) ParseInput(buffer []byte) (*RPCRequest, error) {
 }
 
 // HandleErr sends error response
-func (s *Service) HandleErr(conn *net.UDPConn, addr *net.UDPAddr, message string, err error) {
+func (s *Service) HandleErr(conn Transport, addr net.Addr, message string, err error) {
 	resp := RPCResponse{
 		Status: "ERROR",
 		Error:  fmt.Sprintf("%s: %v", message, err),
 	}
 
-	respData, _ := json.Marshal(resp)
-	conn.WriteToUDP(respData, addr)
+	respData, _ := s.encoder.Encode(&resp)
+	if err := s.send(conn, respData, addr); err != nil {
+		s.logger.Error("sending response", "status", "ERROR", "error", err)
+	}
+
+	s.logger.Error(message, "source", addrString(addr), "error", err)
+}
+
+// writePacket sends data as one datagram. Datagram writes are all or
+// nothing in practice, but a short write would deliver a response the
+// peer cannot parse, so it is reported as an error.
+func writePacket(conn Transport, data []byte, addr net.Addr) error {
+	n, err := conn.WriteTo(data, addr)
+	if err != nil {
+		return err
+	}
+
+	if n < len(data) {
+		return fmt.Errorf("short write: wrote %d of %d bytes", n, len(data))
+	}
 
-	log.Printf("Error: %s - %v", message, err)
+	return nil
 }
 
-func (s *Service) ExecuteMethod(req *RPCRequest) *RPCResponse {
-	if _, loaded := s.requestLog.LoadOrStore(req.RequestID, true); loaded {
+func (s *Service) ExecuteMethod(ctx *CallContext, req *RPCRequest) *RPCResponse {
+	if req.Validate {
+		return s.validateRequest(req)
+	}
+
+	// Checked before dedup so the answer to a challenge, which reuses
+	// the RequestID, is not taken for a duplicate.
+	if s.challenges.required(req.Method) && !s.challenges.verify(req.Nonce, req.Method, ctx.Source) {
+		message := "echo the nonce to prove the source address"
+		if req.Nonce != "" {
+			message = "invalid or expired nonce"
+		}
+
+		return &RPCResponse{
+			RequestID: req.RequestID,
+			Status:    "CHALLENGE",
+			Error:     message,
+			Nonce:     s.challenges.issue(req.Method, ctx.Source),
+		}
+	}
+
+	// Also before dedup: a TRANSIENT request did not run, so its retry
+	// must run rather than be answered DUPLICATE.
+	if s.injectTransient(req) {
+		return &RPCResponse{
+			RequestID: req.RequestID,
+			Status:    "TRANSIENT",
+			Error:     "simulated transient failure, retry the request",
+		}
+	}
+
+	if s.requestLog.MarkSeen(s.dedupKey(req)) {
 		return &RPCResponse{
 			RequestID: req.RequestID,
 			Status:    "DUPLICATE",
@@ -97,45 +607,53 @@ func (s *Service) ExecuteMethod(req *RPCRequest) *RPCResponse {
 		}
 	}
 
-	// Clean up old requests periodically (in production, use proper cleanup)
-	go func() {
-		time.Sleep(5 * time.Minute)
-		s.requestLog.Delete(req.RequestID)
-	}()
-
 	var result interface{}
 	var err error
 
-	if rand.Intn(5) == 0 {
-		log.Printf("Simulating delay for request %s", req.RequestID)
-		time.Sleep(3 * time.Second)
-	}
-
-	switch req.Method {
-	case "add":
-		result, err = s.add(req.Params)
-	case "subtract":
-		result, err = s.subtract(req.Params)
-	case "multiply":
-		result, err = s.multiply(req.Params)
-	case "divide":
-		result, err = s.divide(req.Params)
-	case "get_time":
-		result, err = s.getTime(req.Params)
-	case "reverse_string":
-		result, err = s.reverseString(req.Params)
-	case "echo":
-		result, err = s.echo(req.Params)
-	default:
-		err = fmt.Errorf("unknown method: %s", req.Method)
+	s.injectDelay(req)
+
+	// A request without a params field decodes to a nil map, which reads
+	// as every parameter having the wrong type. Say what is really wrong.
+	missingParams := req.Params == nil
+	if missingParams {
+		req.Params = map[string]interface{}{}
+	}
+
+	if method, ok := s.methods[req.Method]; ok {
+		if missingParams && requiresParams(req.Method) {
+			err = fmt.Errorf("params object is required")
+		} else {
+			result, err = s.callWithTimeout(ctx, req.Method, method, req.Params)
+		}
+	} else {
+		err = s.unknownMethodError(req.Method)
 	}
 
 	if err != nil {
-		return &RPCResponse{
+		resp := &RPCResponse{
 			RequestID: req.RequestID,
 			Status:    "ERROR",
 			Error:     err.Error(),
 		}
+
+		var methodErr *MethodError
+		if errors.As(err, &methodErr) {
+			resp.ErrorData = methodErr.Data
+			if methodErr.Status != "" {
+				resp.Status = methodErr.Status
+			}
+		}
+
+		return resp
+	}
+
+	if partial, ok := result.(*partialResult); ok {
+		return &RPCResponse{
+			RequestID: req.RequestID,
+			Result:    partial.value,
+			Status:    "OK",
+			Partial:   true,
+		}
 	}
 
 	return &RPCResponse{
@@ -145,63 +663,165 @@ func (s *Service) ExecuteMethod(req *RPCRequest) *RPCResponse {
 	}
 }
 
-// RPC Methods Implementation
-func (s *Service) add(params map[string]interface{}) (interface{}, error) {
-	a, ok1 := params["a"].(float64)
-	b, ok2 := params["b"].(float64)
+// validateRequest answers a dry-run request. It has no side effects, so
+// it bypasses duplicate detection.
+func (s *Service) validateRequest(req *RPCRequest) *RPCResponse {
+	if _, ok := s.methods[req.Method]; !ok {
+		return &RPCResponse{
+			RequestID: req.RequestID,
+			Status:    "ERROR",
+			Error:     s.unknownMethodError(req.Method).Error(),
+		}
+	}
+
+	problems := s.validateParams(req.Method, req.Params)
 
-	if !ok1 || !ok2 {
-		return nil, fmt.Errorf("parameters 'a' and 'b' must be numbers")
+	result := map[string]interface{}{"valid": len(problems) == 0}
+	if len(problems) > 0 {
+		result["errors"] = problems
 	}
 
-	return a + b, nil
+	return &RPCResponse{
+		RequestID: req.RequestID,
+		Result:    result,
+		Status:    "OK",
+	}
 }
 
-func (s *Service) subtract(params map[string]interface{}) (interface{}, error) {
-	a, ok1 := params["a"].(float64)
-	b, ok2 := params["b"].(float64)
+// callWithTimeout runs method under its effective timeout. A method that
+// overruns is reported as TIMEOUT; its context is cancelled so it can
+// stop early, and whatever it returns afterwards is discarded.
+func (s *Service) callWithTimeout(ctx *CallContext, name string, method methodFunc, params map[string]interface{}) (interface{}, error) {
+	timeout := s.methodTimeout(name)
+	if timeout <= 0 {
+		return method(ctx, params)
+	}
+
+	timed, cancel := context.WithTimeout(ctx.Context, timeout)
+	defer cancel()
+
+	callCtx := *ctx
+	callCtx.Context = timed
 
-	if !ok1 || !ok2 {
-		return nil, fmt.Errorf("parameters 'a' and 'b' must be numbers")
+	type outcome struct {
+		result interface{}
+		err    error
 	}
+	done := make(chan outcome, 1)
 
-	return a - b, nil
+	go func() {
+		result, err := method(&callCtx, params)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-timed.Done():
+		if partialMethods[name] {
+			select {
+			case out := <-done:
+				if out.err == nil {
+					return out.result, nil
+				}
+			case <-time.After(partialGrace):
+			}
+		}
+		return nil, &MethodError{
+			Message: fmt.Sprintf("method %s timed out after %v", name, timeout),
+			Status:  "TIMEOUT",
+		}
+	}
 }
 
-func (s *Service) multiply(params map[string]interface{}) (interface{}, error) {
-	a, ok1 := params["a"].(float64)
-	b, ok2 := params["b"].(float64)
+// methodTimeout returns the per-method override if one is configured and
+// the global request timeout otherwise. Zero means no timeout.
+func (s *Service) methodTimeout(name string) time.Duration {
+	if timeout, ok := s.cfg.MethodTimeouts[name]; ok {
+		return timeout
+	}
+
+	return s.cfg.RequestTimeout
+}
 
-	if !ok1 || !ok2 {
-		return nil, fmt.Errorf("parameters 'a' and 'b' must be numbers")
+// RPC Methods Implementation
+func (s *Service) add(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := s.getOperands(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a + b, nil
+}
+
+func (s *Service) subtract(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := s.getOperands(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return a - b, nil
+}
+
+func (s *Service) multiply(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, b, err := s.getOperands(params)
+	if err != nil {
+		return nil, err
 	}
 
 	return a * b, nil
 }
 
-func (s *Service) divide(params map[string]interface{}) (interface{}, error) {
-	a, ok1 := params["a"].(float64)
-	b, ok2 := params["b"].(float64)
+// divide returns a / b. With integer_division set both operands must be
+// whole numbers and the quotient is truncated toward zero, as in Go.
+func (s *Service) divide(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	integerDivision, err := getOptionalBool(params, "integer_division", false)
+	if err != nil {
+		return nil, err
+	}
 
-	if !ok1 || !ok2 {
-		return nil, fmt.Errorf("parameters 'a' and 'b' must be numbers")
+	a, b, err := s.getOperands(params)
+	if err != nil {
+		return nil, err
 	}
 
 	if b == 0 {
-		return nil, fmt.Errorf("division by zero")
+		return nil, &MethodError{
+			Message: "division by zero",
+			Data:    map[string]interface{}{"a": a, "b": b},
+		}
+	}
+
+	if !integerDivision {
+		return a / b, nil
+	}
+
+	// a and b are already parsed, so quoted numbers work here too when
+	// LenientNumbers is on.
+	ia, err := wholeNumber("a", a)
+	if err != nil {
+		return nil, err
+	}
+
+	ib, err := wholeNumber("b", b)
+	if err != nil {
+		return nil, err
 	}
 
-	return a / b, nil
+	return ia / ib, nil
 }
 
-func (s *Service) getTime(params map[string]interface{}) (interface{}, error) {
+func (s *Service) getTime(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
 	return time.Now().Unix(), nil
 }
 
-func (s *Service) reverseString(params map[string]interface{}) (interface{}, error) {
+func (s *Service) reverseString(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
 	str, ok := params["s"].(string)
 	if !ok {
-		return nil, fmt.Errorf("parameter 's' must be a string")
+		return nil, &MethodError{
+			Message: "parameter 's' must be a string",
+			Data:    map[string]interface{}{"s": params["s"]},
+		}
 	}
 
 	runes := []rune(str)
@@ -212,174 +832,442 @@ func (s *Service) reverseString(params map[string]interface{}) (interface{}, err
 	return string(runes), nil
 }
 
-func (s *Service) echo(params map[string]interface{}) (interface{}, error) {
+func (s *Service) echo(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
 	return params, nil
 }
 
-func handleMessage(conn *net.UDPConn, addr *net.UDPAddr, buffer []byte) {
-	service := &Service{}
+func (s *Service) handleMessage(conn Transport, addr net.Addr, buffer []byte) {
+	// A request too large for one datagram arrives in chunks and is
+	// handled once the last one is in. Its digest goes back in the
+	// response so the client can tell the request arrived intact.
+	var uploadDigest string
+	if chunk, ok := parseChunk(buffer); ok {
+		whole, digest, done, err := s.uploads.add(addr, chunk)
+		if err != nil {
+			s.HandleErr(conn, addr, "error assembling request", err)
+			return
+		}
+		if !done {
+			return
+		}
+		buffer, uploadDigest = whole, digest
+	}
+
+	s.tails.touch(addr)
 
-	msg, err := service.ParseInput(buffer)
+	msg, err := s.ParseInput(buffer)
 	if err != nil {
-		service.HandleErr(conn, addr, "error parsing inputs", err)
+		s.traffic.parseErrors.Add(1)
+		s.audit.Record(&RPCRequest{}, addr, "ERROR")
+		s.HandleErr(conn, addr, "error parsing inputs", err)
 		return
 	}
 
-	log.Printf("Received request: %s from %s", msg.Method, addr.String())
+	if s.currentState() != stateReady && !drainExempt[msg.Method] {
+		s.reject(conn, addr, msg, "DRAINING", "server is draining and not accepting new requests", 0)
+		return
+	}
 
 	// Process request
-	resp := service.ExecuteMethod(msg)
+	callCtx := newCallContext(msg, addr)
+	start := time.Now()
+	defer s.running(msg, start)()
+	resp := s.ExecuteMethod(callCtx, msg)
+	resp.UploadDigest = uploadDigest
+
+	if result, ok := resp.Result.(*multiResult); ok {
+		s.audit.Record(msg, addr, resp.Status)
+		s.metrics.record(resp.Status)
+		s.tracer.record(callCtx, msg.Method, resp.Status, start)
+
+		stampResponse(resp, start)
+		if err := s.sendStream(conn, addr, resp, result); err != nil {
+			s.logger.Error("sending response", "request_id", resp.RequestID, "stream", true, "error", err)
+			return
+		}
+
+		s.logAccess(msg, addr, resp.Status)
+		return
+	}
+
+	if tail, ok := resp.Result.(*logTail); ok {
+		s.audit.Record(msg, addr, resp.Status)
+		s.metrics.record(resp.Status)
+		s.tracer.record(callCtx, msg.Method, resp.Status, start)
+
+		stampResponse(resp, start)
+		s.tails.start(s, conn, resp, tail)
+
+		s.logAccess(msg, addr, resp.Status)
+		return
+	}
 
 	// Marshal response
-	respData, err := json.Marshal(resp)
+	stampResponse(resp, start)
+	respData, err := s.encoder.Encode(resp)
+
+	// JSON has no Inf or NaN, so a result such as 1/0 would otherwise
+	// fail to marshal and the client would never hear back.
+	var unsupported *json.UnsupportedValueError
+	if errors.As(err, &unsupported) {
+		resp = &RPCResponse{
+			RequestID: msg.RequestID,
+			Status:    "ERROR",
+			Error:     "result is not finite",
+		}
+		stampResponse(resp, start)
+		respData, err = s.encoder.Encode(resp)
+	}
+
+	s.audit.Record(msg, addr, resp.Status)
+	s.metrics.record(resp.Status)
+	s.tracer.record(callCtx, msg.Method, resp.Status, start)
+
 	if err != nil {
-		service.HandleErr(conn, addr, "error marshaling response", err)
+		s.HandleErr(conn, addr, "error marshaling response", err)
 		return
 	}
 
 	// Send response
-	_, err = conn.WriteToUDP(respData, addr)
+	err = s.send(conn, s.compressResponse(resp, respData), addr)
 	if err != nil {
-		log.Printf("Error sending response: %v", err)
+		s.logger.Error("sending response", "request_id", resp.RequestID, "error", err)
+		return
 	}
 
-	log.Printf("Sent response for request: %s", msg.RequestID)
+	s.logAccess(msg, addr, resp.Status)
 }
 
-func Run(cfg *Config) {
-	udpAddr := &net.UDPAddr{
-		IP:   cfg.GetIpv4Addr(),
-		Port: cfg.Port,
-	}
+// stampResponse sets the server timing fields of a response about to be
+// sent for a request handled since start.
+func stampResponse(resp *RPCResponse, start time.Time) {
+	now := time.Now()
+	resp.Timestamp = now.UnixMilli()
+	resp.ProcessingMs = now.Sub(start).Milliseconds()
+}
 
-	conn, err := net.ListenUDP("udp", udpAddr)
-	if err != nil {
-		log.Fatal("Error listening UDP:", err)
-	}
-	defer conn.Close()
+// Client implementation
+type RPCClient struct {
+	ServerAddr net.Addr
+	Conn       Transport
+	Timeout    time.Duration
+	MaxRetries int
 
-	log.Printf("RPC Server listening on %s:%d", cfg.Host, cfg.Port)
-	log.Printf("Available methods: add, subtract, multiply, divide, get_time, reverse_string, echo")
+	// Backoff is the wait between attempts after a timeout: retry n
+	// waits n times Backoff. Zero means 500ms.
+	Backoff time.Duration
 
-	for {
-		buffer := make([]byte, 1024)
+	// RetryBudget, when set, caps retries across all calls. Once it is
+	// empty calls fail after their first attempt until it refills. The
+	// same budget may be shared by several clients.
+	RetryBudget *RetryBudget
 
-		n, addr, err := conn.ReadFromUDP(buffer)
-		if err != nil {
-			log.Printf("Error reading from UDP: %v", err)
-			continue
-		}
+	// IDGen, when set, generates RequestIDs instead of the default
+	// random UUIDs, e.g. to make tests deterministic.
+	IDGen func() string
+
+	// BufferSize is the largest response the client accepts. A larger
+	// one fails the call with a "response truncated" error. Zero means
+	// defaultBufferSize, which is also the most it can be.
+	BufferSize int
 
-		go handleMessage(conn, addr, buffer[:n])
+	// mux is the socket behind Conn. It may be shared with other clients.
+	mux *ClientConn
+
+	coalesce coalescer
+}
+
+func (c *RPCClient) backoff() time.Duration {
+	if c.Backoff > 0 {
+		return c.Backoff
 	}
+
+	return defaultBackoff
 }
 
-// Client implementation
-type RPCClient struct {
-	ServerAddr *net.UDPAddr
-	Conn       *net.UDPConn
-	Timeout    time.Duration
-	MaxRetries int
+func (c *RPCClient) bufferSize() int {
+	if c.BufferSize > 0 {
+		return min(c.BufferSize, defaultBufferSize)
+	}
+
+	return defaultBufferSize
 }
 
+// NewRPCClient creates a client with its own socket on an ephemeral port.
+// Use ClientConn.NewClient to put many clients on one socket instead.
 func NewRPCClient(serverHost string, serverPort int, timeout time.Duration, maxRetries int) (*RPCClient, error) {
-	serverAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d", serverHost, serverPort))
+	mux, err := ListenClientConn(0)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.ListenUDP("udp", nil)
+	client, err := mux.NewClient(serverHost, serverPort, timeout, maxRetries)
 	if err != nil {
+		mux.Close()
 		return nil, err
 	}
 
-	return &RPCClient{
-		ServerAddr: serverAddr,
-		Conn:       conn,
-		Timeout:    timeout,
-		MaxRetries: maxRetries,
-	}, nil
+	return client, nil
+}
+
+// NewUnixRPCClient creates a client for a server on the Unix datagram
+// socket at socketPath. Replies are received on localPath.
+func NewUnixRPCClient(socketPath, localPath string, timeout time.Duration, maxRetries int) (*RPCClient, error) {
+	mux, err := ListenUnixClientConn(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return mux.NewUnixClient(socketPath, timeout, maxRetries), nil
 }
 
 func (c *RPCClient) Call(method string, params map[string]interface{}) (*RPCResponse, error) {
-	requestID := generateRequestID()
+	return c.call(&RPCRequest{Method: method, Params: params}, c.MaxRetries)
+}
 
-	req := RPCRequest{
-		RequestID: requestID,
-		Method:    method,
-		Params:    params,
-		Timestamp: time.Now().Unix(),
+// CallOnce sends the request exactly once, ignoring MaxRetries, and
+// returns the first response or a timeout. Use it for methods with side
+// effects where a blind retry could run them twice.
+func (c *RPCClient) CallOnce(method string, params map[string]interface{}) (*RPCResponse, error) {
+	return c.call(&RPCRequest{Method: method, Params: params}, 0)
+}
+
+// CallInto calls method and decodes its result into out, which must be a
+// pointer. A response whose status is not OK is returned as an error.
+func (c *RPCClient) CallInto(method string, params map[string]interface{}, out interface{}) error {
+	resp, err := c.Call(method, params)
+	if err != nil {
+		return err
 	}
 
-	reqData, err := json.Marshal(req)
+	if resp.Status != "OK" {
+		return fmt.Errorf("%s failed with status %s: %s", method, resp.Status, resp.Error)
+	}
+
+	// Result was already decoded into generic values, so round-trip it
+	// through JSON to get it into out's type.
+	data, err := json.Marshal(resp.Result)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding %s result: %v", method, err)
+	}
+
+	return nil
+}
+
+// Validate asks the server to check params against method's schema
+// without executing it. The result holds "valid" and, when invalid,
+// the list of "errors".
+func (c *RPCClient) Validate(method string, params map[string]interface{}) (*RPCResponse, error) {
+	return c.call(&RPCRequest{Method: method, Params: params, Validate: true}, c.MaxRetries)
+}
+
+func (c *RPCClient) call(req *RPCRequest, maxRetries int) (*RPCResponse, error) {
+	reqData, err := c.marshalRequest(req)
 	if err != nil {
 		return nil, err
 	}
+	requestID := req.RequestID
+
+	resultChan := c.mux.register(requestID, c.bufferSize())
+	defer c.mux.unregister(requestID)
 
 	var lastErr error
-	for retry := 0; retry <= c.MaxRetries; retry++ {
-		if retry > 0 {
-			log.Printf("Retry %d for request %s", retry, requestID)
+	answered, resend := false, false
+	for retry := 0; retry <= maxRetries; retry++ {
+		if retry > 0 && !resend {
+			if !c.RetryBudget.allow() {
+				return nil, fmt.Errorf("retry budget exhausted: %v", lastErr)
+			}
+			slog.Info("retrying request", "request_id", requestID, "retry", retry)
 		}
 
+		resend = false
 		ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
-		defer cancel()
 
 		// Send request
-		_, err = c.Conn.WriteToUDP(reqData, c.ServerAddr)
+		err = c.writeRequest(requestID, reqData)
 		if err != nil {
+			cancel()
 			lastErr = err
 			continue
 		}
 
 		// Wait for response with timeout
-		responseChan := make(chan *RPCResponse)
-		errorChan := make(chan error)
-
-		go func() {
-			buffer := make([]byte, 1024)
-			n, _, err := c.Conn.ReadFromUDP(buffer)
-			if err != nil {
-				errorChan <- err
-				return
+		result, ok := awaitResult(ctx, resultChan)
+		cancel()
+		if ok && result.err == nil && result.resp.UploadDigest != "" && result.resp.UploadDigest != digestHex(reqData) {
+			// The server ran something other than what was sent.
+			return nil, fmt.Errorf("request corrupted in transit: server digest %s does not match", result.resp.UploadDigest)
+		}
+		if ok && !answered && result.err == nil && result.resp.Status == "CHALLENGE" {
+			// The method has not run, so answering does not count as
+			// a retry.
+			answered, resend = true, true
+			req.Nonce = result.resp.Nonce
+			if reqData, err = json.Marshal(req); err != nil {
+				return nil, err
 			}
+			retry--
+			continue
+		}
+		if ok && retry < maxRetries && result.err == nil && result.resp.RetryAfterMs > 0 {
+			// The server asked us to back off; its hint replaces the
+			// usual backoff schedule.
+			lastErr = fmt.Errorf("server answered %s", result.resp.Status)
+			time.Sleep(time.Duration(result.resp.RetryAfterMs) * time.Millisecond)
+			continue
+		}
+		if ok && result.err == nil && result.resp.Status == "TRANSIENT" {
+			lastErr = fmt.Errorf("server answered TRANSIENT: %s", result.resp.Error)
+		} else if ok {
+			// A response that arrived but could not be read will not
+			// get any better by retrying.
+			return result.resp, result.err
+		} else {
+			lastErr = fmt.Errorf("timeout after %v", c.Timeout)
+		}
 
-			var resp RPCResponse
-			if err := json.Unmarshal(buffer[:n], &resp); err != nil {
-				errorChan <- err
-				return
-			}
+		// Wait before retry
+		if retry < maxRetries {
+			time.Sleep(time.Duration(retry+1) * c.backoff())
+		}
+	}
 
-			responseChan <- &resp
-		}()
+	return nil, fmt.Errorf("max retries exceeded: %v", lastErr)
+}
 
+// awaitResult waits for the first usable response until ctx is done.
+// When an earlier attempt was only delayed, a retry makes the server
+// answer DUPLICATE while the original response is still in flight, so
+// those are skipped in favour of the real answer. Later copies are
+// dropped by the ClientConn once the call unregisters.
+//
+// If no real answer comes, the original response was lost after the
+// request ran, and the DUPLICATE is returned: retrying again would only
+// be answered DUPLICATE too.
+func awaitResult(ctx context.Context, resultChan chan rpcResult) (rpcResult, bool) {
+	var duplicate *rpcResult
+
+	for {
 		select {
-		case resp := <-responseChan:
-			return resp, nil
-		case err := <-errorChan:
-			lastErr = err
+		case result := <-resultChan:
+			if result.err == nil && result.resp.Status == "DUPLICATE" {
+				duplicate = &result
+				continue
+			}
+			return result, true
 		case <-ctx.Done():
-			lastErr = fmt.Errorf("timeout after %v", c.Timeout)
+			if duplicate != nil {
+				return *duplicate, true
+			}
+			return rpcResult{}, false
 		}
+	}
+}
 
-		// Wait before retry
-		if retry < c.MaxRetries {
-			time.Sleep(time.Duration(retry+1) * 500 * time.Millisecond)
+// Send fires a request without waiting for the response and returns its
+// RequestID. The response is buffered until it is retrieved with Collect.
+func (c *RPCClient) Send(method string, params map[string]interface{}) (string, error) {
+	req := &RPCRequest{Method: method, Params: params}
+
+	reqData, err := c.marshalRequest(req)
+	if err != nil {
+		return "", err
+	}
+	requestID := req.RequestID
+
+	c.mux.register(requestID, c.bufferSize())
+
+	if err := c.writeRequest(requestID, reqData); err != nil {
+		c.mux.unregister(requestID)
+		return "", err
+	}
+
+	return requestID, nil
+}
+
+// Collect waits up to timeout for the response to a request started with
+// Send. On timeout the request stays pending so Collect can be retried.
+func (c *RPCClient) Collect(requestID string, timeout time.Duration) (*RPCResponse, error) {
+	resultChan, ok := c.mux.lookup(requestID)
+	if !ok {
+		return nil, fmt.Errorf("unknown request id: %s", requestID)
+	}
+
+	select {
+	case result := <-resultChan:
+		c.mux.unregister(requestID)
+		return result.resp, result.err
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timeout after %v", timeout)
+	}
+}
+
+// writeRequest sends an encoded request, splitting it into chunks when it
+// is larger than the server reads in one datagram.
+func (c *RPCClient) writeRequest(requestID string, data []byte) error {
+	if len(data) <= readBufferSize {
+		return writePacket(c.Conn, data, c.ServerAddr)
+	}
+
+	packets, err := splitRequest(requestID, data)
+	if err != nil {
+		return err
+	}
+
+	for _, packet := range packets {
+		if err := writePacket(c.Conn, packet, c.ServerAddr); err != nil {
+			return err
 		}
 	}
 
-	return nil, fmt.Errorf("max retries exceeded: %v", lastErr)
+	return nil
+}
+
+// marshalRequest stamps req with a fresh RequestID and timestamp and
+// encodes it.
+func (c *RPCClient) marshalRequest(req *RPCRequest) ([]byte, error) {
+	if c.IDGen != nil {
+		req.RequestID = c.IDGen()
+	} else {
+		req.RequestID = generateRequestID()
+	}
+	req.Timestamp = time.Now().Unix()
+
+	return json.Marshal(req)
+}
+
+// RetryBudget is a token bucket of retries: each retry spends a token and
+// tokens refill at a steady rate.
+type RetryBudget struct {
+	bucket *tokenBucket
+}
+
+// NewRetryBudget allows bursts of up to maxRetries retries, refilled at
+// refillPerSecond.
+func NewRetryBudget(maxRetries int, refillPerSecond float64) *RetryBudget {
+	return &RetryBudget{bucket: newTokenBucket(float64(maxRetries), refillPerSecond)}
 }
 
-func generateRequestID() string {
-	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Intn(1000))
+// allow spends a token for one retry. A nil budget never runs out.
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	return b.bucket.take()
 }
 
 // Example client usage
 func runClientExample() {
 	client, err := NewRPCClient("127.0.0.1", 5000, 2*time.Second, 3)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("creating client", "error", err)
+		os.Exit(1)
 	}
 	defer client.Conn.Close()
 
@@ -408,37 +1296,8 @@ func runClientExample() {
 
 		fmt.Printf("Response: Status=%s, Result=%v, Error=%s\n",
 			resp.Status, resp.Result, resp.Error)
-	}
-}
-
-func main() {
-	// Default configuration
-	cfg := &Config{
-		Host: "0.0.0.0",
-		Port: 5000,
-	}
-
-	// Parse command line arguments
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "server":
-			if len(os.Args) > 2 {
-				port, err := strconv.Atoi(os.Args[2])
-				if err == nil {
-					cfg.Port = port
-				}
-			}
-			Run(cfg)
-		case "client":
-			runClientExample()
-		default:
-			fmt.Println("Usage:")
-			fmt.Println("  go run main.go server [port] - Start RPC server")
-			fmt.Println("  go run main.go client      - Run client example")
-			fmt.Println("Default port: 5000")
+		if resp.ErrorData != nil {
+			fmt.Printf("Error data: %v\n", resp.ErrorData)
 		}
-	} else {
-		fmt.Println("Please specify 'server' or 'client' mode")
-		fmt.Println("Example: go run main.go server 5000")
 	}
 }
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+type paramType string
+
+const (
+	typeNumber  paramType = "number"
+	typeInteger paramType = "integer"
+	typeString  paramType = "string"
+	typeBool    paramType = "boolean"
+	typeArray   paramType = "array"
+	typeObject  paramType = "object"
+
+	// typeJSON is any object or array, for methods that take a JSON
+	// document as is.
+	typeJSON paramType = "object or array"
+
+	// typeBigInteger is an integer that may also be sent as a decimal
+	// string, for values a JSON number cannot hold exactly.
+	typeBigInteger paramType = "integer or decimal string"
+)
+
+// paramSpec describes one parameter of a method.
+type paramSpec struct {
+	Name     string
+	Type     paramType
+	Optional bool
+}
+
+// methodSchemas lists the parameters each method takes. It only covers
+// presence and types; checks such as division by zero stay in the methods.
+var methodSchemas = map[string][]paramSpec{
+	"add":      {{Name: "a", Type: typeNumber}, {Name: "b", Type: typeNumber}},
+	"subtract": {{Name: "a", Type: typeNumber}, {Name: "b", Type: typeNumber}},
+	"multiply": {{Name: "a", Type: typeNumber}, {Name: "b", Type: typeNumber}},
+	"divide": {
+		{Name: "a", Type: typeNumber},
+		{Name: "b", Type: typeNumber},
+		{Name: "integer_division", Type: typeBool, Optional: true},
+	},
+	"get_time":       {},
+	"reverse_string": {{Name: "s", Type: typeString}},
+	"echo":           {},
+	"eval":           {{Name: "expr", Type: typeString}},
+	"bit_and":        {{Name: "a", Type: typeInteger}, {Name: "b", Type: typeInteger}},
+	"bit_or":         {{Name: "a", Type: typeInteger}, {Name: "b", Type: typeInteger}},
+	"bit_xor":        {{Name: "a", Type: typeInteger}, {Name: "b", Type: typeInteger}},
+	"shift_left":     {{Name: "a", Type: typeInteger}, {Name: "bits", Type: typeInteger}},
+	"shift_right":    {{Name: "a", Type: typeInteger}, {Name: "bits", Type: typeInteger}},
+	"format_number": {
+		{Name: "value", Type: typeNumber},
+		{Name: "decimals", Type: typeInteger, Optional: true},
+		{Name: "thousands_sep", Type: typeString, Optional: true},
+		{Name: "decimal_sep", Type: typeString, Optional: true},
+	},
+	"config":    {},
+	"repeat":    {{Name: "s", Type: typeString}, {Name: "count", Type: typeInteger}},
+	"factorize": {{Name: "n", Type: typeBigInteger}, {Name: "grouped", Type: typeBool, Optional: true}, {Name: "allow_partial", Type: typeBool, Optional: true}},
+	"count_occurrences": {
+		{Name: "s", Type: typeString},
+		{Name: "substr", Type: typeString},
+		{Name: "overlapping", Type: typeBool, Optional: true},
+	},
+	"is_palindrome": {
+		{Name: "s", Type: typeString},
+		{Name: "ignore_case", Type: typeBool, Optional: true},
+		{Name: "ignore_spaces", Type: typeBool, Optional: true},
+		{Name: "ignore_punctuation", Type: typeBool, Optional: true},
+	},
+	"json_path": {{Name: "data", Type: typeJSON}, {Name: "path", Type: typeString}},
+	"drain":     {{Name: "token", Type: typeString}},
+	"health":    {},
+	"regex_match": {
+		{Name: "s", Type: typeString},
+		{Name: "pattern", Type: typeString},
+		{Name: "groups", Type: typeBool, Optional: true},
+	},
+	"checksum": {{Name: "data", Type: typeString}, {Name: "algo", Type: typeString}},
+	"truncate": {
+		{Name: "s", Type: typeString},
+		{Name: "max_len", Type: typeInteger},
+		{Name: "ellipsis", Type: typeString, Optional: true},
+	},
+	"number_to_words": {{Name: "value", Type: typeInteger}},
+	"distance": {
+		{Name: "p1", Type: typeArray},
+		{Name: "p2", Type: typeArray},
+		{Name: "metric", Type: typeString, Optional: true},
+	},
+	"fibonacci": {{Name: "n", Type: typeInteger}},
+	"histogram": {
+		{Name: "values", Type: typeArray},
+		{Name: "bins", Type: typeInteger, Optional: true},
+		{Name: "edges", Type: typeArray, Optional: true},
+	},
+	"to_base":        {{Name: "value", Type: typeInteger}, {Name: "base", Type: typeInteger}},
+	"to_binary":      {{Name: "value", Type: typeInteger}},
+	"to_hex":         {{Name: "value", Type: typeInteger}},
+	"sort":           {{Name: "values", Type: typeArray}, {Name: "desc", Type: typeBool, Optional: true}},
+	"moving_average": {{Name: "values", Type: typeArray}, {Name: "window", Type: typeInteger}},
+	"levenshtein": {
+		{Name: "a", Type: typeString},
+		{Name: "b", Type: typeString},
+		{Name: "normalized", Type: typeBool, Optional: true},
+	},
+	"set_op": {
+		{Name: "a", Type: typeArray},
+		{Name: "b", Type: typeArray},
+		{Name: "op", Type: typeString},
+	},
+	"weighted_average": {{Name: "values", Type: typeArray}, {Name: "weights", Type: typeArray}},
+	"reset_cache":      {{Name: "token", Type: typeString}},
+	"heat_index":       {{Name: "temp_f", Type: typeNumber}, {Name: "humidity", Type: typeNumber}},
+	"json_merge": {
+		{Name: "a", Type: typeObject},
+		{Name: "b", Type: typeObject},
+		{Name: "array_strategy", Type: typeString, Optional: true},
+	},
+	"net_stats": {},
+	"base_convert": {
+		{Name: "value", Type: typeString},
+		{Name: "from_base", Type: typeInteger},
+		{Name: "to_base", Type: typeInteger},
+	},
+	"log_snapshot": {{Name: "token", Type: typeString}, {Name: "lines", Type: typeInteger, Optional: true}},
+	"tail_logs":    {{Name: "token", Type: typeString}, {Name: "lines", Type: typeInteger, Optional: true}},
+	"unsubscribe":  {{Name: "token", Type: typeString}, {Name: "subscription_id", Type: typeString}},
+	"percentile":   {{Name: "values", Type: typeArray}, {Name: "p", Type: typeNumber}},
+	"round_half_even": {
+		{Name: "value", Type: typeNumber},
+		{Name: "decimals", Type: typeInteger, Optional: true},
+	},
+	"matrix_multiply": {{Name: "a", Type: typeArray}, {Name: "b", Type: typeArray}},
+	"top_n": {
+		{Name: "values", Type: typeArray},
+		{Name: "n", Type: typeInteger},
+		{Name: "largest", Type: typeBool, Optional: true},
+	},
+	"url_encode": {{Name: "s", Type: typeString}, {Name: "path", Type: typeBool, Optional: true}},
+	"url_decode": {{Name: "s", Type: typeString}, {Name: "path", Type: typeBool, Optional: true}},
+	"is_prime":   {{Name: "n", Type: typeInteger}},
+	"next_prime": {{Name: "n", Type: typeInteger}},
+	"zip":        {{Name: "arrays", Type: typeArray}},
+	"unzip":      {{Name: "tuples", Type: typeArray}},
+	"csv_parse": {
+		{Name: "data", Type: typeString},
+		{Name: "delimiter", Type: typeString, Optional: true},
+		{Name: "has_header", Type: typeBool, Optional: true},
+	},
+	"date_parse": {
+		{Name: "value", Type: typeString},
+		{Name: "layout", Type: typeString},
+		{Name: "timezone", Type: typeString, Optional: true},
+	},
+	"date_format": {
+		{Name: "timestamp", Type: typeInteger},
+		{Name: "layout", Type: typeString},
+		{Name: "timezone", Type: typeString, Optional: true},
+	},
+	"flatten": {{Name: "values", Type: typeArray}, {Name: "deep", Type: typeBool, Optional: true}},
+	"chunk":   {{Name: "values", Type: typeArray}, {Name: "size", Type: typeInteger}},
+	"geo_distance": {
+		{Name: "lat1", Type: typeNumber},
+		{Name: "lon1", Type: typeNumber},
+		{Name: "lat2", Type: typeNumber},
+		{Name: "lon2", Type: typeNumber},
+		{Name: "unit", Type: typeString, Optional: true},
+	},
+	"to_roman":   {{Name: "value", Type: typeInteger}},
+	"from_roman": {{Name: "numeral", Type: typeString}},
+	"set_log_level": {
+		{Name: "token", Type: typeString},
+		{Name: "level", Type: typeString},
+	},
+	"dedupe":          {{Name: "values", Type: typeArray}, {Name: "sorted", Type: typeBool, Optional: true}},
+	"text_stats":      {{Name: "s", Type: typeString}},
+	"capabilities":    {},
+	"transform_array": {{Name: "values", Type: typeArray}, {Name: "op", Type: typeString}, {Name: "fn", Type: typeString}},
+	"list_methods":    {},
+}
+
+// exclusiveParams lists, per method, optional parameters of which exactly
+// one must be given. A paramSpec alone cannot say that.
+var exclusiveParams = map[string][]string{
+	"histogram": {"bins", "edges"},
+}
+
+// requiresParams reports whether method has any non-optional parameter.
+func requiresParams(method string) bool {
+	for _, spec := range methodSchemas[method] {
+		if !spec.Optional {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateParams checks params against the method's schema and returns
+// one message per problem found.
+func (s *Service) validateParams(method string, params map[string]interface{}) []string {
+	problems := make([]string, 0)
+
+	for _, spec := range methodSchemas[method] {
+		raw, ok := params[spec.Name]
+		if !ok {
+			if !spec.Optional {
+				problems = append(problems, fmt.Sprintf("parameter '%s' is required", spec.Name))
+			}
+			continue
+		}
+
+		if !s.hasType(raw, spec.Type) {
+			problems = append(problems, fmt.Sprintf("parameter '%s' must be of type %s", spec.Name, spec.Type))
+		}
+	}
+
+	if names := exclusiveParams[method]; names != nil {
+		given := 0
+		for _, name := range names {
+			if _, ok := params[name]; ok {
+				given++
+			}
+		}
+		if given != 1 {
+			problems = append(problems, fmt.Sprintf("exactly one of '%s' is required", strings.Join(names, "' or '")))
+		}
+	}
+
+	return problems
+}
+
+func (s *Service) hasType(raw interface{}, want paramType) bool {
+	switch want {
+	case typeNumber:
+		_, ok := s.getFloat(raw)
+		return ok
+	case typeInteger:
+		value, ok := raw.(float64)
+		return ok && value == math.Trunc(value)
+	case typeString:
+		_, ok := raw.(string)
+		return ok
+	case typeBool:
+		_, ok := raw.(bool)
+		return ok
+	case typeArray:
+		_, ok := raw.([]interface{})
+		return ok
+	case typeObject:
+		_, ok := raw.(map[string]interface{})
+		return ok
+	case typeJSON:
+		return s.hasType(raw, typeObject) || s.hasType(raw, typeArray)
+	case typeBigInteger:
+		if digits, ok := raw.(string); ok {
+			_, ok := new(big.Int).SetString(digits, 10)
+			return ok
+		}
+		return s.hasType(raw, typeInteger)
+	default:
+		return false
+	}
+}
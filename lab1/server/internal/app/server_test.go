@@ -0,0 +1,1057 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+func TestStructuredErrorData(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	resp := ts.call(t, "divide", params{"a": 1, "b": 0})
+	if resp.Status != "ERROR" {
+		t.Fatalf("status %s, want ERROR", resp.Status)
+	}
+	if !jsonEqual(t, resp.ErrorData, params{"a": 1, "b": 0}) {
+		t.Errorf("error data %v, want the operands", resp.ErrorData)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		params params
+		want   interface{}
+		status string
+	}{
+		{"valid", "add", params{"a": 1, "b": 2}, params{"valid": true}, "OK"},
+		{"missing", "add", params{"a": 1}, params{"valid": false, "errors": []string{"parameter 'b' is required"}}, "OK"},
+		{"wrong type", "repeat", params{"s": "x", "count": 1.5}, params{"valid": false, "errors": []string{"parameter 'count' must be of type integer"}}, "OK"},
+		{"top-level array", "json_path", params{"data": []int{1, 2}, "path": "[1]"}, params{"valid": true}, "OK"},
+		{"not json", "json_path", params{"data": "x", "path": "a"}, params{"valid": false, "errors": []string{"parameter 'data' must be of type object or array"}}, "OK"},
+		{"one of two", "histogram", params{"values": []int{1}, "bins": 2}, params{"valid": true}, "OK"},
+		{"neither of two", "histogram", params{"values": []int{1}}, params{"valid": false, "errors": []string{"exactly one of 'bins' or 'edges' is required"}}, "OK"},
+		{"both of two", "histogram", params{"values": []int{1}, "bins": 2, "edges": []int{0, 1}}, params{"valid": false, "errors": []string{"exactly one of 'bins' or 'edges' is required"}}, "OK"},
+		{"unknown method", "nope", params{}, nil, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ts.client(t).Validate(tt.method, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.status {
+				t.Fatalf("status %s, want %s", resp.Status, tt.status)
+			}
+			if tt.want != nil && !jsonEqual(t, resp.Result, tt.want) {
+				t.Errorf("result %s, want %s", mustMarshal(t, resp.Result), mustMarshal(t, tt.want))
+			}
+		})
+	}
+
+	// Validation must not execute or remember the request.
+	if resp := ts.call(t, "add", params{"a": 1, "b": 2}); resp.Status != "OK" {
+		t.Errorf("add after validate: %s", resp.Status)
+	}
+}
+
+func TestMissingParams(t *testing.T) {
+	ts := newTestServer(t, nil)
+	conn := ts.listen(t)
+
+	tests := []struct {
+		method string
+		status string
+		error  string
+	}{
+		{"add", "ERROR", "params object is required"},
+		{"health", "OK", ""},
+	}
+
+	for _, tt := range tests {
+		data, ok := ts.exchange(t, conn, []byte(`{"request_id":"missing-`+tt.method+`","method":"`+tt.method+`"}`), time.Second)
+		if !ok {
+			t.Fatalf("%s: no response", tt.method)
+		}
+
+		resp := decodeResponse(t, data)
+		if resp.Status != tt.status || resp.Error != tt.error {
+			t.Errorf("%s: got %s %q, want %s %q", tt.method, resp.Status, resp.Error, tt.status, tt.error)
+		}
+	}
+}
+
+func TestNonFiniteResult(t *testing.T) {
+	ts := newTestServer(t, &config.Config{LenientNumbers: true})
+	conn := ts.listen(t)
+
+	tests := []struct {
+		name    string
+		request []byte
+		error   string
+	}{
+		{"infinite result", rawRequest(t, "inf", "multiply", params{"a": 1e308, "b": 10}), "result is not finite"},
+		{"NaN string", rawRequest(t, "nan-string", "add", params{"a": "NaN", "b": 1}), "must be numbers"},
+		{"infinite string", rawRequest(t, "inf-string", "add", params{"a": "-Inf", "b": 1}), "must be numbers"},
+		{"NaN literal", []byte(`{"request_id":"nan","method":"add","params":{"a":NaN,"b":1}}`), "failed to parse JSON"},
+	}
+
+	for _, tt := range tests {
+		data, ok := ts.exchange(t, conn, tt.request, time.Second)
+		if !ok {
+			t.Fatalf("%s: no response", tt.name)
+		}
+
+		resp := decodeResponse(t, data)
+		if resp.Status != "ERROR" || !strings.Contains(resp.Error, tt.error) {
+			t.Errorf("%s: got %s %q, want ERROR about %q", tt.name, resp.Status, resp.Error, tt.error)
+		}
+	}
+}
+
+func TestResponseTiming(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	before := time.Now().UnixMilli()
+	resp := ts.call(t, "get_time", nil)
+
+	if resp.Timestamp < before || resp.Timestamp > time.Now().UnixMilli() {
+		t.Errorf("timestamp %d is not the time of the call", resp.Timestamp)
+	}
+	if resp.ProcessingMs < 0 {
+		t.Errorf("processing_ms %d is negative", resp.ProcessingMs)
+	}
+}
+
+func TestLenientNumbers(t *testing.T) {
+	tests := []struct {
+		lenient bool
+		method  string
+		params  params
+		status  string
+		want    interface{}
+	}{
+		{false, "add", params{"a": " 5 ", "b": 7}, "ERROR", nil},
+		{true, "add", params{"a": " 5 ", "b": 7}, "OK", 12.0},
+		{true, "divide", params{"a": "17", "b": "5", "integer_division": true}, "OK", 3.0},
+		{true, "divide", params{"a": "1.5", "b": 5, "integer_division": true}, "ERROR", nil},
+	}
+
+	for _, tt := range tests {
+		ts := newTestServer(t, &config.Config{LenientNumbers: tt.lenient})
+
+		resp := ts.call(t, tt.method, tt.params)
+		if resp.Status != tt.status || (tt.want != nil && resp.Result != tt.want) {
+			t.Errorf("lenient=%v: %s %v = %s %v (%s), want %s %v", tt.lenient, tt.method, tt.params, resp.Status, resp.Result, resp.Error, tt.status, tt.want)
+		}
+	}
+}
+
+func TestResponseSizeCap(t *testing.T) {
+	ts := newTestServer(t, &config.Config{MaxResponseSize: 10})
+
+	tests := []struct {
+		count  int
+		status string
+	}{
+		{5, "OK"},
+		{6, "RESPONSE_TOO_LARGE"},
+	}
+
+	for _, tt := range tests {
+		resp := ts.call(t, "repeat", params{"s": "ab", "count": tt.count})
+		if resp.Status != tt.status {
+			t.Errorf("repeat ab %d: status %s, want %s", tt.count, resp.Status, tt.status)
+		}
+	}
+}
+
+func TestMethodTimeout(t *testing.T) {
+	ts := newTestServer(t, &config.Config{
+		MethodTimeouts: map[string]time.Duration{"factorize": 20 * time.Millisecond},
+	})
+
+	// A prime just under 2^53 takes far longer than 20ms to factor.
+	resp := ts.call(t, "factorize", params{"n": 9007199254740881})
+	if resp.Status != "TIMEOUT" {
+		t.Errorf("status %s, want TIMEOUT", resp.Status)
+	}
+
+	// Other methods are not affected by the override.
+	if resp := ts.call(t, "add", params{"a": 1, "b": 2}); resp.Status != "OK" {
+		t.Errorf("add: status %s, want OK", resp.Status)
+	}
+}
+
+func TestDuplicateDetection(t *testing.T) {
+	tests := []struct {
+		name      string
+		dedupKey  string
+		second    params
+		secondRun string
+	}{
+		{"same request", "", params{"a": 1, "b": 2}, "DUPLICATE"},
+		{"same id other params", "", params{"a": 5, "b": 5}, "DUPLICATE"},
+		{"payload key same request", "payload", params{"a": 1, "b": 2}, "DUPLICATE"},
+		{"payload key other params", "payload", params{"a": 5, "b": 5}, "OK"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t, &config.Config{DedupKey: tt.dedupKey})
+			conn := ts.listen(t)
+
+			first, _ := ts.exchange(t, conn, rawRequest(t, "dup", "add", params{"a": 1, "b": 2}), time.Second)
+			if resp := decodeResponse(t, first); resp.Status != "OK" {
+				t.Fatalf("first: status %s, want OK", resp.Status)
+			}
+
+			second, _ := ts.exchange(t, conn, rawRequest(t, "dup", "add", tt.second), time.Second)
+			if resp := decodeResponse(t, second); resp.Status != tt.secondRun {
+				t.Errorf("second: status %s, want %s", resp.Status, tt.secondRun)
+			}
+		})
+	}
+}
+
+func TestResetCache(t *testing.T) {
+	ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+	conn := ts.listen(t)
+
+	request := rawRequest(t, "again", "add", params{"a": 1, "b": 2})
+	ts.exchange(t, conn, request, time.Second)
+
+	if resp := ts.call(t, "reset_cache", params{"token": "wrong"}); resp.Status != "UNAUTHORIZED" {
+		t.Errorf("wrong token: status %s, want UNAUTHORIZED", resp.Status)
+	}
+
+	resp := ts.call(t, "reset_cache", params{"token": "secret"})
+	if resp.Status != "OK" {
+		t.Fatalf("reset_cache: status %s (%s)", resp.Status, resp.Error)
+	}
+
+	data, _ := ts.exchange(t, conn, request, time.Second)
+	if resp := decodeResponse(t, data); resp.Status != "OK" {
+		t.Errorf("request after reset: status %s, want OK", resp.Status)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+
+	if resp := ts.call(t, "drain", params{"token": "nope"}); resp.Status != "UNAUTHORIZED" {
+		t.Fatalf("drain without the token: status %s, want UNAUTHORIZED", resp.Status)
+	}
+
+	resp := ts.call(t, "drain", params{"token": "secret"})
+	if resp.Status != "OK" {
+		t.Fatalf("drain: status %s (%s)", resp.Status, resp.Error)
+	}
+
+	if resp := ts.call(t, "add", params{"a": 1, "b": 2}); resp.Status != "DRAINING" {
+		t.Errorf("add while draining: status %s, want DRAINING", resp.Status)
+	}
+
+	resp = ts.call(t, "health", nil)
+	want := params{"status": "draining", "ready": false}
+	result, _ := resp.Result.(map[string]interface{})
+	if resp.Status != "OK" || result["status"] != want["status"] || result["ready"] != want["ready"] {
+		t.Errorf("health while draining: %s %v", resp.Status, resp.Result)
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	tests := []struct {
+		state   serverState
+		handler http.HandlerFunc
+		code    int
+	}{
+		{stateReady, ts.serveReady, http.StatusOK},
+		{stateReady, ts.serveHealthz, http.StatusOK},
+		{stateDraining, ts.serveReady, http.StatusServiceUnavailable},
+		{stateDraining, ts.serveHealthz, http.StatusOK},
+		{stateShuttingDown, ts.serveHealthz, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		ts.advanceState(tt.state)
+
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: code %d, want %d", tt.state, rec.Code, tt.code)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	ts.call(t, "add", params{"a": 1, "b": 2})
+	ts.call(t, "divide", params{"a": 1, "b": 0})
+
+	rec := httptest.NewRecorder()
+	ts.metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	for _, line := range []string{
+		"rpc_requests_total 2",
+		`rpc_responses_total{status="ERROR"} 1`,
+		`rpc_responses_total{status="OK"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, rec.Body.String())
+		}
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	ts := newTestServer(t, &config.Config{ChallengeMethods: []string{"echo"}})
+	conn := ts.listen(t)
+
+	data, _ := ts.exchange(t, conn, rawRequest(t, "c1", "echo", params{"x": 1}), time.Second)
+	challenge := decodeResponse(t, data)
+	if challenge.Status != "CHALLENGE" || challenge.Nonce == "" {
+		t.Fatalf("first answer %s with nonce %q, want a CHALLENGE", challenge.Status, challenge.Nonce)
+	}
+
+	tests := []struct {
+		name   string
+		nonce  string
+		status string
+	}{
+		{"forged nonce", "1.abc", "CHALLENGE"},
+		{"echoed nonce", challenge.Nonce, "OK"},
+	}
+
+	for _, tt := range tests {
+		request := mustMarshal(t, RPCRequest{RequestID: "c1", Method: "echo", Params: params{"x": 1}, Nonce: tt.nonce})
+		data, _ := ts.exchange(t, conn, request, time.Second)
+		if resp := decodeResponse(t, data); resp.Status != tt.status {
+			t.Errorf("%s: status %s, want %s", tt.name, resp.Status, tt.status)
+		}
+	}
+
+	// RPCClient answers the challenge by itself.
+	if resp := ts.call(t, "echo", params{"x": 1}); resp.Status != "OK" {
+		t.Errorf("client call: status %s, want OK", resp.Status)
+	}
+
+	// Methods not listed are not challenged.
+	if resp := ts.call(t, "add", params{"a": 1, "b": 2}); resp.Status != "OK" {
+		t.Errorf("add: status %s, want OK", resp.Status)
+	}
+}
+
+func TestOkDataEnvelope(t *testing.T) {
+	ts := newTestServer(t, &config.Config{ResponseEnvelope: "ok_data"})
+	conn := ts.listen(t)
+
+	tests := []struct {
+		name    string
+		request []byte
+		want    params
+	}{
+		{"ok", rawRequest(t, "e1", "add", params{"a": 1, "b": 2}), params{"ok": true, "data": 3}},
+		{"error", rawRequest(t, "e2", "divide", params{"a": 1, "b": 0}), params{"ok": false, "error": "division by zero"}},
+		{"duplicate", rawRequest(t, "e1", "add", params{"a": 1, "b": 2}), params{"ok": false, "code": "DUPLICATE"}},
+	}
+
+	for _, tt := range tests {
+		data, ok := ts.exchange(t, conn, tt.request, time.Second)
+		if !ok {
+			t.Fatalf("%s: no response", tt.name)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range tt.want {
+			if !jsonEqual(t, got[key], value) {
+				t.Errorf("%s: %s = %v, want %v in %s", tt.name, key, got[key], value, data)
+			}
+		}
+	}
+}
+
+func TestBadDatagrams(t *testing.T) {
+	ts := newTestServer(t, nil)
+	conn := ts.listen(t)
+
+	// An empty datagram gets no reply at all.
+	if data, ok := ts.exchange(t, conn, nil, 50*time.Millisecond); ok {
+		t.Errorf("empty datagram answered with %s", data)
+	}
+
+	data, ok := ts.exchange(t, conn, []byte("not json"), time.Second)
+	if !ok {
+		t.Fatal("malformed datagram was not answered")
+	}
+	if resp := decodeResponse(t, data); resp.Status != "ERROR" {
+		t.Errorf("malformed datagram: status %s, want ERROR", resp.Status)
+	}
+
+	resp := ts.call(t, "net_stats", nil)
+	stats, _ := resp.Result.(map[string]interface{})
+	want := params{"packets_received": 3, "empty_packets": 1, "parse_errors": 1}
+	for key, value := range want {
+		if !jsonEqual(t, stats[key], value) {
+			t.Errorf("%s = %v, want %v", key, stats[key], value)
+		}
+	}
+}
+
+func TestCompressedResponse(t *testing.T) {
+	ts := newTestServer(t, &config.Config{CompressThreshold: 100, MaxResponseSize: 1000})
+	conn := ts.listen(t)
+
+	data, _ := ts.exchange(t, conn, rawRequest(t, "z1", "repeat", params{"s": "ab", "count": 300}), time.Second)
+	if resp := decodeResponse(t, data); !resp.Compressed || resp.Payload == "" {
+		t.Errorf("large response was not compressed: %s", data)
+	}
+
+	data, _ = ts.exchange(t, conn, rawRequest(t, "z2", "add", params{"a": 1, "b": 2}), time.Second)
+	if resp := decodeResponse(t, data); resp.Compressed {
+		t.Errorf("small response was compressed: %s", data)
+	}
+
+	// The client unpacks compressed responses transparently.
+	resp := ts.call(t, "repeat", params{"s": "ab", "count": 300})
+	if resp.Result != strings.Repeat("ab", 300) {
+		t.Errorf("client got %v", resp.Result)
+	}
+}
+
+func TestStreamedResult(t *testing.T) {
+	ts := newTestServer(t, nil)
+	conn := ts.listen(t)
+
+	// 2^50 has fifty factors, more than one datagram holds.
+	if _, err := conn.WriteTo(rawRequest(t, "s1", "factorize", params{"n": 1 << 50}), ts.conn.Addr()); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := 0
+	for {
+		data, ok := receive(conn, time.Second)
+		if !ok {
+			t.Fatalf("stream ended after %d parts without a final one", parts)
+		}
+
+		resp := decodeResponse(t, data)
+		if !resp.Stream || resp.Seq != parts {
+			t.Fatalf("part %d: stream=%v seq=%d", parts, resp.Stream, resp.Seq)
+		}
+		parts++
+		if resp.Final {
+			break
+		}
+	}
+	if parts < 2 {
+		t.Errorf("result came in %d part, want several", parts)
+	}
+
+	resp := ts.call(t, "factorize", params{"n": 1 << 50})
+	factors, _ := resp.Result.([]interface{})
+	if len(factors) != 50 {
+		t.Errorf("client assembled %d factors, want 50", len(factors))
+	}
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	ts := newTestServer(t, &config.Config{MaxRequestsPerSecond: 1})
+	conn := ts.listen(t)
+
+	tests := []struct {
+		id     string
+		status string
+	}{
+		{"r1", "OK"},
+		{"r2", "OVERLOADED"},
+	}
+
+	for _, tt := range tests {
+		data, _ := ts.exchange(t, conn, rawRequest(t, tt.id, "add", params{"a": 1, "b": 2}), time.Second)
+		resp := decodeResponse(t, data)
+		if resp.Status != tt.status {
+			t.Errorf("%s: status %s, want %s", tt.id, resp.Status, tt.status)
+		}
+		if tt.status == "OVERLOADED" && resp.RetryAfterMs <= 0 {
+			t.Errorf("%s: OVERLOADED without a retry_after_ms hint", tt.id)
+		}
+	}
+}
+
+func TestShedRetryAfter(t *testing.T) {
+	ts := newTestServer(t, &config.Config{MaxRequestsPerSecond: 1000})
+	conn := ts.listen(t)
+
+	// The bucket is still full, so wait returns zero, as it does when a
+	// token comes back between take and wait.
+	ts.shed(ts.conn, conn.Addr(), rawRequest(t, "r1", "add", nil))
+
+	data, ok := receive(conn, time.Second)
+	if !ok {
+		t.Fatal("no reply")
+	}
+	resp := decodeResponse(t, data)
+	if resp.Status != "OVERLOADED" || resp.RetryAfterMs < 1 {
+		t.Errorf("got %s with retry_after_ms %d, want OVERLOADED with at least 1", resp.Status, resp.RetryAfterMs)
+	}
+}
+
+func TestTransientFaults(t *testing.T) {
+	ts := newTestServer(t, &config.Config{FaultTransientRate: 1})
+
+	client := ts.client(t)
+	client.MaxRetries = 1
+	client.Backoff = time.Millisecond
+
+	_, err := client.Call("add", params{"a": 1, "b": 2})
+	if err == nil || !strings.Contains(err.Error(), "TRANSIENT") {
+		t.Errorf("got %v, want retries to end in TRANSIENT", err)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	ts := newTestServer(t, &config.Config{
+		LogSampleRates: map[string]int{"add": 3},
+	})
+
+	for i := 0; i < 6; i++ {
+		ts.call(t, "add", params{"a": 1, "b": 2})
+		ts.call(t, "subtract", params{"a": 1, "b": 2})
+	}
+
+	counts := map[string]int{}
+	for _, line := range ts.logs.tail(logRingSize) {
+		for _, method := range []string{"add", "subtract"} {
+			if strings.Contains(line, "msg=request method="+method+" ") {
+				counts[method]++
+			}
+		}
+	}
+
+	if counts["add"] != 2 || counts["subtract"] != 6 {
+		t.Errorf("logged %v, want 2 of 6 adds and every subtract", counts)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	ts := newTestServer(t, &config.Config{AdminToken: "secret"})
+
+	tests := []struct {
+		level  string
+		status string
+		want   interface{}
+	}{
+		{"debug", "OK", params{"previous": "INFO", "level": "DEBUG"}},
+		{"loud", "ERROR", nil},
+		{"warn", "OK", params{"previous": "DEBUG", "level": "WARN"}},
+	}
+
+	for _, tt := range tests {
+		resp := ts.call(t, "set_log_level", params{"token": "secret", "level": tt.level})
+		if resp.Status != tt.status {
+			t.Fatalf("%s: status %s, want %s", tt.level, resp.Status, tt.status)
+		}
+		if tt.want != nil && !jsonEqual(t, resp.Result, tt.want) {
+			t.Errorf("%s: result %v, want %v", tt.level, resp.Result, tt.want)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ts := newTestServer(t, &config.Config{AuditLogPath: path, AuditRedactMethods: []string{"echo"}})
+
+	ts.call(t, "add", params{"a": 1, "b": 2})
+	ts.call(t, "echo", params{"password": "hunter2"})
+	ts.audit.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	if entries[0].Method != "add" || entries[0].Status != "OK" || entries[0].Params == nil {
+		t.Errorf("add entry %+v", entries[0])
+	}
+	if entries[1].Method != "echo" || !entries[1].Redacted || entries[1].Params != nil {
+		t.Errorf("echo entry %+v is not redacted", entries[1])
+	}
+}
+
+func TestIdleDone(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	if ts.idleDone(t.Context(), 0) != nil {
+		t.Error("a zero idle timeout should never fire")
+	}
+
+	select {
+	case <-ts.idleDone(t.Context(), 20*time.Millisecond):
+	case <-time.After(time.Second):
+		t.Error("idle timeout did not fire")
+	}
+}
+
+// keepDefaultLoggers puts the slog and log package defaults back when the
+// test ends, since Run points both at its own logger.
+func keepDefaultLoggers(t *testing.T) {
+	prev, output, flags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prev)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	})
+}
+
+func TestRunShutdown(t *testing.T) {
+	keepDefaultLoggers(t)
+
+	before := runtime.NumGoroutine()
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Addr:       "127.0.0.1",
+		SocketPath: filepath.Join(dir, "server.sock"),
+		LogLevel:   slog.LevelError,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Run(ctx, cfg)
+	}()
+
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+		if _, err := os.Stat(cfg.SocketPath); err == nil {
+			break
+		}
+		if time.Since(start) > time.Second {
+			cancel()
+			t.Fatal("server socket never appeared")
+		}
+	}
+
+	cc, err := ListenUnixClientConn(filepath.Join(dir, "client.sock"))
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	client := cc.NewUnixClient(cfg.SocketPath, time.Second, 0)
+
+	// Serve a few requests, so the dedup log is used.
+	for i := 0; i < 3; i++ {
+		if resp, err := client.Call("add", params{"a": i, "b": 1}); err != nil || resp.Status != "OK" {
+			t.Errorf("add: %v %v", resp, err)
+		}
+	}
+	cc.Close()
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after its context was cancelled")
+	}
+
+	// Nothing Run started, the request log included, may
+	// outlive it.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		buf := make([]byte, 64<<10)
+		t.Errorf("%d goroutines after Run returned, %d before:\n%s", after, before, buf[:runtime.Stack(buf, true)])
+	}
+
+	if _, err := os.Stat(cfg.SocketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestUnixgramRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	serverPath := filepath.Join(dir, "server.sock")
+	clientPath := filepath.Join(dir, "client.sock")
+
+	// A file left behind by an earlier run is replaced, not an error.
+	if err := os.WriteFile(serverPath, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := NewService(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := listenUnixgram(serverPath)
+	if err != nil {
+		t.Fatalf("listenUnixgram over a stale file: %v", err)
+	}
+	defer conn.Close()
+	go service.Serve(conn)
+
+	cc, err := ListenUnixClientConn(clientPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := cc.NewUnixClient(serverPath, time.Second, 0)
+
+	resp, err := client.Call("add", params{"a": 5, "b": 7})
+	if err != nil || resp.Status != "OK" || resp.Result != 12.0 {
+		t.Errorf("add over unixgram: %v %v", resp, err)
+	}
+
+	// A second conn cannot take a path in use, and failing leaves the
+	// first one's socket alone.
+	if _, err := ListenUnixClientConn(clientPath); err == nil {
+		t.Error("second conn bound a path in use")
+	}
+	if _, err := os.Stat(clientPath); err != nil {
+		t.Errorf("failed bind removed the socket in use: %v", err)
+	}
+
+	cc.Close()
+	if _, err := os.Stat(clientPath); !os.IsNotExist(err) {
+		t.Errorf("client socket left behind after Close: %v", err)
+	}
+}
+
+func TestRunRemovesSocketOnError(t *testing.T) {
+	keepDefaultLoggers(t)
+
+	// Take the UDP port so Run fails after binding its Unix socket.
+	taken, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	cfg := &config.Config{
+		Addr:       "127.0.0.1",
+		Port:       taken.LocalAddr().(*net.UDPAddr).Port,
+		SocketPath: filepath.Join(t.TempDir(), "server.sock"),
+		LogLevel:   slog.LevelError,
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		Run(context.Background(), cfg)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept going without its UDP port")
+	}
+
+	if _, err := os.Stat(cfg.SocketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+// runningService is a service started with run on a Unix socket in a
+// temporary directory, with a client connected to it. Cancelling stop
+// shuts it down.
+type runningService struct {
+	*Service
+	client  *RPCClient
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+// startRun builds a service from cfg, applies setup to it and runs it
+// until the test ends or the service stops by itself.
+func startRun(t *testing.T, cfg *config.Config, setup ...func(*Service)) *runningService {
+	t.Helper()
+
+	keepDefaultLoggers(t)
+
+	dir := t.TempDir()
+	cfg.Addr = "127.0.0.1"
+	cfg.SocketPath = filepath.Join(dir, "server.sock")
+
+	service, err := NewService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range setup {
+		f(service)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := &runningService{Service: service, stop: cancel, stopped: make(chan struct{})}
+	go func() {
+		defer close(rs.stopped)
+		service.run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-rs.stopped
+	})
+
+	for start := time.Now(); ; time.Sleep(5 * time.Millisecond) {
+		if _, err := os.Stat(cfg.SocketPath); err == nil {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("server socket never appeared")
+		}
+	}
+
+	cc, err := ListenUnixClientConn(filepath.Join(dir, "client.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	rs.client = cc.NewUnixClient(cfg.SocketPath, time.Second, 0)
+
+	return rs
+}
+
+// logged reports whether a line containing all of parts is in the
+// service's recent log.
+func (s *Service) logged(parts ...string) bool {
+	for _, line := range s.logs.tail(logRingSize) {
+		found := true
+		for _, part := range parts {
+			found = found && strings.Contains(line, part)
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRunMetricsPortTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	rs := startRun(t, &config.Config{MetricsAddr: taken.Addr().String()})
+
+	if !rs.logged("metrics server disabled", taken.Addr().String(), "address already in use") {
+		t.Errorf("taken metrics port not reported; log:\n%s", strings.Join(rs.logs.tail(logRingSize), "\n"))
+	}
+
+	// The RPC server still starts, and all the way: it reports ready and
+	// answers calls.
+	if state := rs.currentState(); state != stateReady {
+		t.Errorf("state %v, want ready", state)
+	}
+	if resp, err := rs.client.Call("add", params{"a": 2, "b": 3}); err != nil || resp.Status != "OK" || resp.Result != 5.0 {
+		t.Errorf("add: %v %v", resp, err)
+	}
+}
+
+func TestRunShutdownTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	rs := startRun(t, &config.Config{ShutdownTimeout: timeout}, func(s *Service) {
+		s.methods["stuck"] = func(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			return nil, nil
+		}
+	})
+
+	go rs.client.CallOnce("stuck", params{})
+	<-started
+
+	begin := time.Now()
+	rs.stop()
+	select {
+	case <-rs.stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run waited for the stuck handler")
+	}
+	if elapsed := time.Since(begin); elapsed < timeout || elapsed > timeout+time.Second {
+		t.Errorf("run returned after %v, want about %v", elapsed, timeout)
+	}
+
+	if !rs.logged("shutdown timed out", "in_flight=1") || !rs.logged("abandoned request", "method=stuck") {
+		t.Errorf("abandoned request not logged; log:\n%s", strings.Join(rs.logs.tail(logRingSize), "\n"))
+	}
+}
+
+func TestRunIdleTimeout(t *testing.T) {
+	const idle = 100 * time.Millisecond
+
+	rs := startRun(t, &config.Config{IdleTimeout: idle})
+
+	// Traffic more often than the idle timeout keeps run going for
+	// several timeouts.
+	for start := time.Now(); time.Since(start) < 4*idle; time.Sleep(idle / 4) {
+		select {
+		case <-rs.stopped:
+			t.Fatalf("run stopped after %v despite traffic", time.Since(start))
+		default:
+		}
+		if resp, err := rs.client.Call("add", params{"a": 1, "b": 2}); err != nil || resp.Status != "OK" {
+			t.Fatalf("add: %v %v", resp, err)
+		}
+	}
+
+	quiet := time.Now()
+	select {
+	case <-rs.stopped:
+	case <-time.After(idle + 5*time.Second):
+		t.Fatal("run kept going without traffic")
+	}
+	if elapsed := time.Since(quiet); elapsed < idle/2 {
+		t.Errorf("run stopped %v after the last request, want about %v", elapsed, idle)
+	}
+
+	if !rs.logged("no traffic, stopping") {
+		t.Error("idle stop not logged")
+	}
+}
+
+func TestRunStdLogger(t *testing.T) {
+	rs := startRun(t, &config.Config{})
+
+	// A log.Printf line goes through the service logger, so it looks like
+	// one from slog.
+	log.Printf("legacy %s output", "log package")
+	slog.Info("slog output", "n", 1)
+
+	var legacy, structured string
+	for _, line := range rs.logs.tail(logRingSize) {
+		switch {
+		case strings.Contains(line, "legacy"):
+			legacy = line
+		case strings.Contains(line, "slog output"):
+			structured = line
+		}
+	}
+
+	format := regexp.MustCompile(`^time=\S+ level=INFO msg=`)
+	if !format.MatchString(structured) {
+		t.Fatalf("slog.Info wrote %q", structured)
+	}
+	if !format.MatchString(legacy) || !strings.HasSuffix(legacy, `msg="legacy log package output"`) {
+		t.Errorf("log.Printf wrote %q, want the format of %q", legacy, structured)
+	}
+}
+
+func TestReadBufferReuse(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	// Requests of different lengths share recycled buffers; each must
+	// still be answered with exactly its own params.
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			want := params{"s": strings.Repeat("x", 50-i) + fmt.Sprint(i)}
+			resp, err := ts.client(t).Call("echo", want)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !jsonEqual(t, resp.Result, want) {
+				t.Errorf("request %d echoed %v", i, resp.Result)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkServe measures a whole add call over the in-memory network,
+// server and client allocations included. Run it with -benchmem.
+func BenchmarkServe(b *testing.B) {
+	service, err := NewService(&config.Config{LogLevel: slog.LevelError})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	network := NewMemNetwork()
+	conn, _ := network.Listen("server")
+	defer conn.Close()
+	go service.Serve(conn)
+
+	clientConn, _ := network.Listen("client")
+	cc := NewClientConn(clientConn)
+	defer cc.Close()
+	client := cc.NewClientAddr(conn.Addr(), time.Second, 0)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := client.Call("add", params{"a": 1, "b": 2}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+var bufferSink []byte
+
+// BenchmarkReadBuffer compares allocating a read buffer per datagram,
+// as Serve used to, with taking one from readBuffers.
+func BenchmarkReadBuffer(b *testing.B) {
+	b.Run("fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			bufferSink = make([]byte, readBufferSize)
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buffer := readBuffers.Get().(*[]byte)
+			bufferSink = *buffer
+			readBuffers.Put(buffer)
+		}
+	})
+}
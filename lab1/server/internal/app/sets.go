@@ -0,0 +1,100 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+)
+
+// setOp combines arrays a and b as sets. Elements must be all numbers or
+// all strings across both arrays. Duplicates are dropped and the result
+// keeps the order in which elements first appear, a before b.
+func (s *Service) setOp(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	a, ok := params["a"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'a' must be an array")
+	}
+
+	b, ok := params["b"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'b' must be an array")
+	}
+
+	op, ok := params["op"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'op' must be a string")
+	}
+
+	both := append(append([]interface{}{}, a...), b...)
+	if !allOfType[float64](both) && !allOfType[string](both) {
+		return nil, fmt.Errorf("parameters 'a' and 'b' must hold only numbers or only strings")
+	}
+
+	inB := make(map[interface{}]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+
+	var keep func(v interface{}, fromA bool) bool
+	switch op {
+	case "union":
+		keep = func(v interface{}, fromA bool) bool { return true }
+	case "intersection":
+		keep = func(v interface{}, fromA bool) bool { return fromA && inB[v] }
+	case "difference":
+		keep = func(v interface{}, fromA bool) bool { return fromA && !inB[v] }
+	default:
+		return nil, fmt.Errorf("parameter 'op' must be 'union', 'intersection' or 'difference'")
+	}
+
+	result := make([]interface{}, 0)
+	seen := make(map[interface{}]bool, len(both))
+	for i, v := range both {
+		if seen[v] || !keep(v, i < len(a)) {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+// dedupe drops repeated elements from values, keeping the first of each
+// in order, or returns them sorted ascending with the sorted flag.
+// Elements must be all numbers or all strings.
+func (s *Service) dedupe(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, ok := params["values"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'values' must be an array")
+	}
+
+	sorted, err := getOptionalBool(params, "sorted", false)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := allOfType[float64](values)
+	if !numbers && !allOfType[string](values) {
+		return nil, fmt.Errorf("parameter 'values' must hold only numbers or only strings")
+	}
+
+	unique := make([]interface{}, 0, len(values))
+	seen := make(map[interface{}]bool, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	if sorted {
+		sort.Slice(unique, func(i, j int) bool {
+			if numbers {
+				return unique[i].(float64) < unique[j].(float64)
+			}
+			return unique[i].(string) < unique[j].(string)
+		})
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// sortValues sorts an array that holds only numbers or only strings.
+// Strings compare bytewise.
+func (s *Service) sortValues(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, ok := params["values"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("parameter 'values' must be an array")
+	}
+
+	desc, err := getOptionalBool(params, "desc", false)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]interface{}, len(values))
+	copy(sorted, values)
+
+	var less func(i, j int) bool
+	switch {
+	case len(sorted) == 0:
+		return sorted, nil
+	case allOfType[float64](sorted):
+		less = func(i, j int) bool { return sorted[i].(float64) < sorted[j].(float64) }
+	case allOfType[string](sorted):
+		less = func(i, j int) bool { return sorted[i].(string) < sorted[j].(string) }
+	default:
+		return nil, fmt.Errorf("parameter 'values' must hold only numbers or only strings")
+	}
+
+	if desc {
+		asc := less
+		less = func(i, j int) bool { return asc(j, i) }
+	}
+	sort.SliceStable(sorted, less)
+
+	return sorted, nil
+}
+
+// topN returns the n largest (default) or smallest values, best first.
+// It keeps a heap of the n best seen so far, so it runs in O(len log n).
+func (s *Service) topN(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumbers(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := getInt(params, "n")
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > int64(len(values)) {
+		return nil, fmt.Errorf("parameter 'n' must be between 1 and %d", len(values))
+	}
+
+	largest, err := getOptionalBool(params, "largest", true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The heap's root is the worst of the values kept, so it is the one
+	// a better value replaces.
+	worse := func(a, b float64) bool { return a < b }
+	if !largest {
+		worse = func(a, b float64) bool { return a > b }
+	}
+
+	h := &floatHeap{less: worse}
+	for _, v := range values {
+		if h.Len() < int(n) {
+			heap.Push(h, v)
+		} else if worse(h.values[0], v) {
+			h.values[0] = v
+			heap.Fix(h, 0)
+		}
+	}
+
+	best := make([]float64, h.Len())
+	for i := len(best) - 1; i >= 0; i-- {
+		best[i] = heap.Pop(h).(float64)
+	}
+
+	return best, nil
+}
+
+// floatHeap is a container/heap of numbers ordered by less.
+type floatHeap struct {
+	values []float64
+	less   func(a, b float64) bool
+}
+
+func (h *floatHeap) Len() int           { return len(h.values) }
+func (h *floatHeap) Less(i, j int) bool { return h.less(h.values[i], h.values[j]) }
+func (h *floatHeap) Swap(i, j int)      { h.values[i], h.values[j] = h.values[j], h.values[i] }
+func (h *floatHeap) Push(x interface{}) { h.values = append(h.values, x.(float64)) }
+
+func (h *floatHeap) Pop() interface{} {
+	last := h.values[len(h.values)-1]
+	h.values = h.values[:len(h.values)-1]
+	return last
+}
+
+func allOfType[T any](values []interface{}) bool {
+	for _, v := range values {
+		if _, ok := v.(T); !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxHistogramBins keeps the counts list small enough for one datagram.
+const maxHistogramBins = 100
+
+// histogram counts values into buckets given either as a number of
+// equal-width bins over the data's range or as explicit ascending edges.
+// Each bucket includes its lower edge; the last also includes its upper
+// edge. Values outside explicit edges are not counted.
+func (s *Service) histogram(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumbers(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	_, hasBins := params["bins"]
+	_, hasEdges := params["edges"]
+	if hasBins == hasEdges {
+		return nil, fmt.Errorf("exactly one of 'bins' or 'edges' is required")
+	}
+
+	var edges []float64
+	if hasBins {
+		bins, err := getInt(params, "bins")
+		if err != nil {
+			return nil, err
+		}
+		if bins < 1 || bins > maxHistogramBins {
+			return nil, fmt.Errorf("parameter 'bins' must be between 1 and %d", maxHistogramBins)
+		}
+		edges = equalWidthEdges(values, int(bins))
+	} else {
+		edges, err = s.getNumbers(params, "edges")
+		if err != nil {
+			return nil, err
+		}
+		if len(edges) < 2 || len(edges) > maxHistogramBins+1 {
+			return nil, fmt.Errorf("parameter 'edges' must have between 2 and %d elements", maxHistogramBins+1)
+		}
+		for i := 1; i < len(edges); i++ {
+			if edges[i] <= edges[i-1] {
+				return nil, fmt.Errorf("parameter 'edges' must be strictly increasing")
+			}
+		}
+	}
+
+	counts := make([]int, len(edges)-1)
+	last := len(edges) - 1
+	for _, v := range values {
+		if v < edges[0] || v > edges[last] {
+			continue
+		}
+
+		// Index of the first edge above v, so v falls in the bucket before it.
+		i := sort.Search(len(edges), func(i int) bool { return edges[i] > v })
+		counts[min(i, last)-1]++
+	}
+
+	return map[string]interface{}{
+		"edges":  edges,
+		"counts": counts,
+	}, nil
+}
+
+// equalWidthEdges splits the range of values into bins. When every value
+// is the same the range is widened by half a unit each way so the bins
+// still have a width.
+func equalWidthEdges(values []float64, bins int) []float64 {
+	lo, hi := values[0], values[0]
+	for _, v := range values[1:] {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	if lo == hi {
+		lo -= 0.5
+		hi += 0.5
+	}
+
+	edges := make([]float64, bins+1)
+	width := (hi - lo) / float64(bins)
+	for i := range edges {
+		edges[i] = lo + float64(i)*width
+	}
+	// Avoid rounding leaving the maximum just outside the last bucket.
+	edges[bins] = hi
+
+	return edges
+}
+
+// movingAverage returns the mean of each run of window consecutive
+// values, so the result has len(values)-window+1 entries.
+func (s *Service) movingAverage(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumbers(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := getInt(params, "window")
+	if err != nil {
+		return nil, err
+	}
+	if window < 1 || window > int64(len(values)) {
+		return nil, fmt.Errorf("parameter 'window' must be between 1 and %d", len(values))
+	}
+
+	averages := make([]float64, 0, len(values)-int(window)+1)
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= int(window) {
+			sum -= values[i-int(window)]
+		}
+		if i >= int(window)-1 {
+			averages = append(averages, sum/float64(window))
+		}
+	}
+
+	return averages, nil
+}
+
+// weightedAverage returns sum(values[i]*weights[i]) / sum(weights).
+func (s *Service) weightedAverage(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumbers(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	weights, err := s.getNumbers(params, "weights")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != len(weights) {
+		return nil, fmt.Errorf("parameters 'values' and 'weights' must have the same length, got %d and %d", len(values), len(weights))
+	}
+
+	sum, total := 0.0, 0.0
+	for i := range values {
+		sum += values[i] * weights[i]
+		total += weights[i]
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("weights must not sum to zero")
+	}
+
+	return sum / total, nil
+}
+
+// percentile returns the p-th percentile of values, interpolating
+// linearly between the two nearest ranks.
+func (s *Service) percentile(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumbers(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := s.getFloat(params["p"])
+	if !ok {
+		return nil, fmt.Errorf("parameter 'p' must be a number")
+	}
+	if p < 0 || p > 100 {
+		return nil, fmt.Errorf("parameter 'p' must be between 0 and 100")
+	}
+
+	sort.Float64s(values)
+
+	rank := p / 100 * float64(len(values)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+
+	return values[lo] + (rank-float64(lo))*(values[hi]-values[lo]), nil
+}
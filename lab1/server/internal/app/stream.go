@@ -0,0 +1,95 @@
+package app
+
+import (
+	"log/slog"
+	"net"
+)
+
+// streamChunkSize is how many items go in each datagram of a streamed
+// result unless the result sets its own.
+const streamChunkSize = 32
+
+// multiResult is returned by methods whose result is a list that may be
+// too large for one datagram. handleMessage sends it as a stream of
+// responses sharing the RequestID; the last one is marked Final.
+type multiResult struct {
+	items []interface{}
+
+	// chunkSize overrides streamChunkSize for results with large items.
+	chunkSize int
+}
+
+// sendStream sends resp, whose Result is a multiResult, in chunks.
+func (s *Service) sendStream(conn Transport, addr net.Addr, resp *RPCResponse, result *multiResult) error {
+	items := result.items
+	seq := 0
+
+	chunkSize := result.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = streamChunkSize
+	}
+
+	for {
+		n := min(len(items), chunkSize)
+
+		part := *resp
+		part.Result = items[:n]
+		part.Stream = true
+		part.Seq = seq
+		part.Final = n == len(items)
+
+		data, err := s.encoder.Encode(&part)
+		if err != nil {
+			return err
+		}
+
+		if err := s.send(conn, data, addr); err != nil {
+			return err
+		}
+
+		if part.Final {
+			return nil
+		}
+
+		items = items[n:]
+		seq++
+	}
+}
+
+// streamAssembly collects the parts of a streamed response on the client.
+type streamAssembly struct {
+	parts   map[int][]interface{}
+	lastSeq int
+	final   *RPCResponse
+}
+
+// add records one part and returns the combined response once every part
+// up to the final one has arrived.
+func (a *streamAssembly) add(resp *RPCResponse) (*RPCResponse, bool) {
+	items, ok := resp.Result.([]interface{})
+	if !ok && resp.Result != nil {
+		slog.Warn("dropping stream part: result is not a list", "request_id", resp.RequestID, "seq", resp.Seq)
+		return nil, false
+	}
+	a.parts[resp.Seq] = items
+
+	if resp.Final {
+		a.final = resp
+		a.lastSeq = resp.Seq
+	}
+
+	if a.final == nil || len(a.parts) != a.lastSeq+1 {
+		return nil, false
+	}
+
+	combined := make([]interface{}, 0)
+	for seq := 0; seq <= a.lastSeq; seq++ {
+		combined = append(combined, a.parts[seq]...)
+	}
+
+	whole := *a.final
+	whole.Result = combined
+	whole.Seq = 0
+
+	return &whole, true
+}
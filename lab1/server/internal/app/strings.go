@@ -0,0 +1,319 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultMaxResponseSize keeps generated strings well inside a datagram.
+const defaultMaxResponseSize = 512
+
+func (s *Service) maxResponseSize() int {
+	if s.cfg.MaxResponseSize > 0 {
+		return s.cfg.MaxResponseSize
+	}
+
+	return defaultMaxResponseSize
+}
+
+func (s *Service) repeat(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	count, err := getInt(params, "count")
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("parameter 'count' must not be negative")
+	}
+
+	limit := s.maxResponseSize()
+	if len(str) > 0 && count > int64(limit/len(str)) {
+		return nil, &MethodError{
+			Message: fmt.Sprintf("result would exceed %d bytes", limit),
+			Data:    map[string]interface{}{"size": int64(len(str)) * count, "limit": limit},
+			Status:  "RESPONSE_TOO_LARGE",
+		}
+	}
+
+	return strings.Repeat(str, int(count)), nil
+}
+
+// countOccurrences counts substr in s, without overlaps unless the
+// overlapping flag is set.
+func (s *Service) countOccurrences(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	substr, ok := params["substr"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'substr' must be a string")
+	}
+	if substr == "" {
+		return nil, fmt.Errorf("parameter 'substr' must not be empty")
+	}
+
+	overlapping, err := getOptionalBool(params, "overlapping", false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !overlapping {
+		return strings.Count(str, substr), nil
+	}
+
+	count := 0
+	for i := 0; i <= len(str)-len(substr); {
+		j := strings.Index(str[i:], substr)
+		if j < 0 {
+			break
+		}
+		count++
+
+		// Step past the first rune of the match only.
+		_, size := utf8.DecodeRuneInString(str[i+j:])
+		i += j + size
+	}
+
+	return count, nil
+}
+
+// isPalindrome compares runes from both ends, optionally folding case and
+// skipping whitespace or punctuation.
+func (s *Service) isPalindrome(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	ignoreCase, err := getOptionalBool(params, "ignore_case", false)
+	if err != nil {
+		return nil, err
+	}
+
+	ignoreSpaces, err := getOptionalBool(params, "ignore_spaces", false)
+	if err != nil {
+		return nil, err
+	}
+
+	ignorePunct, err := getOptionalBool(params, "ignore_punctuation", false)
+	if err != nil {
+		return nil, err
+	}
+
+	runes := make([]rune, 0, len(str))
+	for _, r := range str {
+		if ignoreSpaces && unicode.IsSpace(r) {
+			continue
+		}
+		if ignorePunct && unicode.IsPunct(r) {
+			continue
+		}
+		if ignoreCase {
+			r = unicode.ToLower(r)
+		}
+		runes = append(runes, r)
+	}
+
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		if runes[i] != runes[j] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// maxPatternLength bounds regex compilation cost. RE2 matching is linear
+// so backtracking is not a risk, but huge patterns are still expensive.
+const maxPatternLength = 256
+
+// regexMatch reports whether pattern matches s and, when groups is set,
+// the full match and its capture groups.
+func (s *Service) regexMatch(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	pattern, ok := params["pattern"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'pattern' must be a string")
+	}
+	if len(pattern) > maxPatternLength {
+		return nil, fmt.Errorf("parameter 'pattern' must be at most %d bytes", maxPatternLength)
+	}
+
+	withGroups, err := getOptionalBool(params, "groups", false)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	if !withGroups {
+		return map[string]interface{}{"matched": re.MatchString(str)}, nil
+	}
+
+	match := re.FindStringSubmatch(str)
+	if match == nil {
+		return map[string]interface{}{"matched": false}, nil
+	}
+
+	return map[string]interface{}{
+		"matched": true,
+		"match":   match[0],
+		"groups":  match[1:],
+	}, nil
+}
+
+// truncate shortens s to at most max_len runes, ending it with ellipsis
+// when anything was cut. The ellipsis counts towards max_len.
+func (s *Service) truncate(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	maxLen, err := getInt(params, "max_len")
+	if err != nil {
+		return nil, err
+	}
+	if maxLen < 0 {
+		return nil, fmt.Errorf("parameter 'max_len' must not be negative")
+	}
+
+	ellipsis, err := getOptionalString(params, "ellipsis", "...")
+	if err != nil {
+		return nil, err
+	}
+
+	runes := []rune(str)
+	if int64(len(runes)) <= maxLen {
+		return str, nil
+	}
+
+	// An ellipsis longer than max_len is cut down itself.
+	tail := []rune(ellipsis)
+	if int64(len(tail)) >= maxLen {
+		return string(tail[:maxLen]), nil
+	}
+
+	keep := int(maxLen) - len(tail)
+
+	return string(runes[:keep]) + ellipsis, nil
+}
+
+// urlEncode percent-encodes s for a query string component, or with
+// path set for a URL path segment.
+func (s *Service) urlEncode(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	path, err := getOptionalBool(params, "path", false)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := url.QueryEscape(str)
+	if path {
+		encoded = url.PathEscape(str)
+	}
+
+	// Escaping can triple the length of its input.
+	if limit := s.maxResponseSize(); len(encoded) > limit {
+		return nil, &MethodError{
+			Message: fmt.Sprintf("result would exceed %d bytes", limit),
+			Data:    map[string]interface{}{"size": len(encoded), "limit": limit},
+			Status:  "RESPONSE_TOO_LARGE",
+		}
+	}
+
+	return encoded, nil
+}
+
+// urlDecode reverses urlEncode. In query mode '+' decodes to a space.
+func (s *Service) urlDecode(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	path, err := getOptionalBool(params, "path", false)
+	if err != nil {
+		return nil, err
+	}
+
+	unescape := url.QueryUnescape
+	if path {
+		unescape = url.PathUnescape
+	}
+
+	decoded, err := unescape(str)
+	if err != nil {
+		return nil, fmt.Errorf("parameter 's' is not validly encoded: %v", err)
+	}
+
+	return decoded, nil
+}
+
+// textStats counts the characters (runes), words and sentences in s.
+// Words are runs of letters, digits and combining marks; a sentence is
+// text ended by '.', '!' or '?', or by the end of s.
+func (s *Service) textStats(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	str, ok := params["s"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 's' must be a string")
+	}
+
+	chars, words, wordRunes, sentences := 0, 0, 0, 0
+	inWord, inSentence := false, false
+
+	for _, r := range str {
+		chars++
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			if !inWord {
+				words++
+			}
+			wordRunes++
+			inWord, inSentence = true, true
+			continue
+		}
+		inWord = false
+
+		if (r == '.' || r == '!' || r == '?') && inSentence {
+			sentences++
+			inSentence = false
+		}
+	}
+	if inSentence {
+		sentences++
+	}
+
+	avgWordLength := 0.0
+	if words > 0 {
+		avgWordLength = float64(wordRunes) / float64(words)
+	}
+
+	return map[string]interface{}{
+		"chars":           chars,
+		"words":           words,
+		"sentences":       sentences,
+		"avg_word_length": avgWordLength,
+	}, nil
+}
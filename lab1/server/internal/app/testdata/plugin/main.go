@@ -0,0 +1,21 @@
+// Command plugin is the method plugin loaded by TestLoadPlugins.
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+var Methods = map[string]func(context.Context, map[string]interface{}) (interface{}, error){
+	"shout": func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		s, _ := params["s"].(string)
+		return strings.ToUpper(s), nil
+	},
+
+	// Built-in methods win, so this must be skipped.
+	"add": func(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+		return "from the plugin", nil
+	},
+}
+
+func main() {}
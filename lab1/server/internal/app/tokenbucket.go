@@ -0,0 +1,58 @@
+package app
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket holds up to capacity tokens and refills at rate tokens per
+// second. It is safe for concurrent use.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity, rate float64) *tokenBucket {
+	return &tokenBucket{
+		capacity: capacity,
+		rate:     rate,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// take removes one token, reporting false if the bucket is empty.
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// wait returns how long until a token is available, without taking one.
+func (b *tokenBucket) wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tokens := b.tokens + time.Since(b.last).Seconds()*b.rate
+	if tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceBatchSize caps how many spans go in one export request.
+const traceBatchSize = 256
+
+// tracer records a span per executed request and exports them to an
+// OpenTelemetry collector as OTLP/HTTP JSON. Like the audit log, spans
+// are queued and sent by a background goroutine; when the queue is full
+// spans are dropped rather than slowing requests down.
+type tracer struct {
+	endpoint string
+	client   *http.Client
+	logger   *slog.Logger
+	spans    chan otlpSpan
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newTracer(endpoint string, logger *slog.Logger) *tracer {
+	t := &tracer{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		logger:   logger,
+		spans:    make(chan otlpSpan, 1024),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+
+	return t
+}
+
+// record queues a span for a request that started at start. It is a
+// no-op on a nil or closed tracer.
+func (t *tracer) record(ctx *CallContext, method, status string, start time.Time) {
+	if t == nil {
+		return
+	}
+
+	span := otlpSpan{
+		TraceID:   otlpTraceID(ctx.TraceID),
+		SpanID:    newSpanID(),
+		Name:      method,
+		Kind:      otlpSpanKindServer,
+		StartTime: strconv.FormatInt(start.UnixNano(), 10),
+		EndTime:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			stringAttribute("rpc.method", method),
+			stringAttribute("rpc.status", status),
+			stringAttribute("rpc.request_id", ctx.RequestID),
+			stringAttribute("client.address", addrString(ctx.Source)),
+		},
+		Status: otlpStatus{Code: otlpStatusOK},
+	}
+	if status != "OK" {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: status}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.spans <- span:
+	default:
+	}
+}
+
+// Close exports queued spans and stops the tracer.
+func (t *tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.spans)
+	t.mu.Unlock()
+
+	<-t.done
+
+	return nil
+}
+
+func (t *tracer) run() {
+	defer close(t.done)
+
+	for span := range t.spans {
+		batch := []otlpSpan{span}
+
+	fill:
+		for len(batch) < traceBatchSize {
+			select {
+			case next, ok := <-t.spans:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		if err := t.export(batch); err != nil {
+			t.logger.Error("exporting spans", "spans", len(batch), "error", err)
+		}
+	}
+}
+
+func (t *tracer) export(spans []otlpSpan) error {
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", "rpc-server")}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "server/internal/app"},
+			Spans: spans,
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// otlpTraceID turns a TraceID into the 16-byte hex form OTLP needs. A
+// UUID, which is what RequestIDs default to, already is one once its
+// dashes are removed; anything else is hashed so the same TraceID always
+// maps to the same trace.
+func otlpTraceID(traceID string) string {
+	compact := strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+	if len(compact) == 32 {
+		if _, err := hex.DecodeString(compact); err == nil {
+			return compact
+		}
+	}
+
+	sum := sha256.Sum256([]byte(traceID))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+func newSpanID() string {
+	var b [8]byte
+	rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+// The types below are the subset of the OTLP JSON encoding the tracer
+// sends.
+
+const (
+	otlpSpanKindServer = 2
+	otlpStatusOK       = 1
+	otlpStatusError    = 2
+)
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID    string          `json:"traceId"`
+	SpanID     string          `json:"spanId"`
+	Name       string          `json:"name"`
+	Kind       int             `json:"kind"`
+	StartTime  string          `json:"startTimeUnixNano"`
+	EndTime    string          `json:"endTimeUnixNano"`
+	Attributes []otlpAttribute `json:"attributes"`
+	Status     otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
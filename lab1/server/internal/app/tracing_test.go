@@ -0,0 +1,206 @@
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/config"
+)
+
+// collector is an OTLP/HTTP endpoint that records what it is sent.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newCollector(t *testing.T, status int) *collector {
+	t.Helper()
+
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		c.mu.Lock()
+		c.requests = append(c.requests, r)
+		c.bodies = append(c.bodies, body)
+		c.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+// testTracer is a tracer whose run loop starts only when start is
+// called, so spans recorded before then are exported as one batch.
+func testTracer(endpoint string) (t *tracer, start func()) {
+	t = &tracer{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: time.Second},
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		spans:    make(chan otlpSpan, 1024),
+		done:     make(chan struct{}),
+	}
+
+	return t, func() { go t.run() }
+}
+
+func TestTracerExport(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	tr, start := testTracer(c.URL + "/v1/traces")
+
+	source := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+	began := time.Unix(1700000000, 0)
+	traceID := "5b8efff7-9803-8103-d269-b633813fc60c"
+
+	tr.record(&CallContext{Context: context.Background(), RequestID: traceID, TraceID: traceID, Source: source}, "add", "OK", began)
+	tr.record(&CallContext{Context: context.Background(), RequestID: "req-2", TraceID: traceID, Source: source}, "divide", "ERROR", began)
+
+	start()
+	tr.Close()
+
+	// Spans recorded after Close are dropped.
+	tr.record(&CallContext{Context: context.Background(), RequestID: "late"}, "add", "OK", began)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.requests) != 1 {
+		t.Fatalf("collector got %d requests, want 1", len(c.requests))
+	}
+
+	r := c.requests[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %s %s with Content-Type %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(c.bodies[0], &got); err != nil {
+		t.Fatalf("decoding export: %v", err)
+	}
+
+	// Span IDs are random and end times are taken from the clock, so
+	// check their form and then mask them before comparing.
+	resourceSpans := got["resourceSpans"].([]interface{})
+	scopeSpans := resourceSpans[0].(map[string]interface{})["scopeSpans"].([]interface{})
+	for _, s := range scopeSpans[0].(map[string]interface{})["spans"].([]interface{}) {
+		span := s.(map[string]interface{})
+
+		if id, err := hex.DecodeString(span["spanId"].(string)); err != nil || len(id) != 8 {
+			t.Errorf("spanId %v is not 8 hex bytes", span["spanId"])
+		}
+		end, err := strconv.ParseInt(span["endTimeUnixNano"].(string), 10, 64)
+		if err != nil || end < began.UnixNano() {
+			t.Errorf("endTimeUnixNano %v is not after the start", span["endTimeUnixNano"])
+		}
+
+		span["spanId"] = "<span id>"
+		span["endTimeUnixNano"] = "<end time>"
+	}
+
+	want, err := os.ReadFile("testdata/otlp_traces.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded interface{}
+	if err := json.Unmarshal(want, &recorded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !jsonEqual(t, got, recorded) {
+		t.Errorf("export does not match testdata/otlp_traces.json:\n%s", c.bodies[0])
+	}
+}
+
+func TestServiceTracing(t *testing.T) {
+	c := newCollector(t, http.StatusOK)
+	ts := newTestServer(t, &config.Config{TraceEndpoint: c.URL})
+
+	ts.call(t, "add", params{"a": 1, "b": 2})
+	ts.tracer.Close()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var spans int
+	for _, body := range c.bodies {
+		var traces otlpTraces
+		if err := json.Unmarshal(body, &traces); err != nil {
+			t.Fatal(err)
+		}
+		for _, rs := range traces.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans++
+					if span.Name != "add" || span.Status.Code != otlpStatusOK {
+						t.Errorf("span %s with status %d, want add OK", span.Name, span.Status.Code)
+					}
+				}
+			}
+		}
+	}
+	if spans != 1 {
+		t.Errorf("exported %d spans, want 1", spans)
+	}
+}
+
+func TestTracerCollectorError(t *testing.T) {
+	c := newCollector(t, http.StatusServiceUnavailable)
+	tr, _ := testTracer(c.URL)
+
+	err := tr.export([]otlpSpan{{Name: "add"}})
+	if err == nil {
+		t.Fatal("export to a failing collector succeeded")
+	}
+}
+
+func TestTracerNil(t *testing.T) {
+	var tr *tracer
+
+	tr.record(&CallContext{Context: context.Background()}, "add", "OK", time.Now())
+	if err := tr.Close(); err != nil {
+		t.Errorf("Close on a nil tracer: %v", err)
+	}
+}
+
+func TestOtlpTraceID(t *testing.T) {
+	tests := []struct {
+		traceID string
+		want    string
+	}{
+		{"5b8efff7-9803-8103-d269-b633813fc60c", "5b8efff798038103d269b633813fc60c"},
+		{"5B8EFFF7-9803-8103-D269-B633813FC60C", "5b8efff798038103d269b633813fc60c"},
+		{"5b8efff798038103d269b633813fc60c", "5b8efff798038103d269b633813fc60c"},
+		// Anything that is not a UUID is hashed; only the form is checked.
+		{"req-1", ""},
+	}
+
+	for _, tt := range tests {
+		got := otlpTraceID(tt.traceID)
+		if tt.want != "" && got != tt.want {
+			t.Errorf("otlpTraceID(%q) = %s, want %s", tt.traceID, got, tt.want)
+		}
+		if id, err := hex.DecodeString(got); err != nil || len(id) != 16 {
+			t.Errorf("otlpTraceID(%q) = %s, not 16 hex bytes", tt.traceID, got)
+		}
+	}
+
+	if otlpTraceID("req-1") != otlpTraceID("req-1") || otlpTraceID("req-1") == otlpTraceID("req-2") {
+		t.Error("hashed trace IDs are not stable and distinct")
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The operations transform_array may apply, by name. Only these run;
+// fn is never evaluated as code.
+var (
+	mapOps = map[string]func(float64) float64{
+		"square": func(x float64) float64 { return x * x },
+		"double": func(x float64) float64 { return 2 * x },
+		"negate": func(x float64) float64 { return -x },
+		"abs":    math.Abs,
+		"sqrt":   math.Sqrt,
+		"floor":  math.Floor,
+		"ceil":   math.Ceil,
+		"round":  math.Round,
+	}
+
+	filterOps = map[string]func(float64) bool{
+		"positive": func(x float64) bool { return x > 0 },
+		"negative": func(x float64) bool { return x < 0 },
+		"nonzero":  func(x float64) bool { return x != 0 },
+		"integer":  func(x float64) bool { return x == math.Trunc(x) },
+		"even":     func(x float64) bool { return math.Mod(x, 2) == 0 },
+		"odd":      func(x float64) bool { return math.Abs(math.Mod(x, 2)) == 1 },
+	}
+
+	reduceOps = map[string]func(acc, x float64) float64{
+		"sum":     func(acc, x float64) float64 { return acc + x },
+		"product": func(acc, x float64) float64 { return acc * x },
+		"min":     math.Min,
+		"max":     math.Max,
+	}
+)
+
+// transformArray applies the named operation fn to values: map replaces
+// each value, filter keeps the values fn holds for, and reduce folds them
+// into a single number from the first value on. Map and filter take an
+// empty array to an empty one; reduce has no first value to start from,
+// so it needs at least one.
+func (s *Service) transformArray(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	values, err := s.getNumberArray(params, "values")
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := params["op"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'op' must be a string")
+	}
+
+	fn, ok := params["fn"].(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'fn' must be a string")
+	}
+
+	var result interface{}
+	switch op {
+	case "map":
+		apply, ok := mapOps[fn]
+		if !ok {
+			return nil, unknownOpError("map", mapOps)
+		}
+		mapped := make([]float64, len(values))
+		for i, v := range values {
+			if fn == "sqrt" && v < 0 {
+				return nil, fmt.Errorf("parameter 'values' element %d must not be negative for sqrt", i)
+			}
+			mapped[i] = apply(v)
+			if math.IsInf(mapped[i], 0) {
+				return nil, fmt.Errorf("%s of parameter 'values' element %d overflows", fn, i)
+			}
+		}
+		result = mapped
+	case "filter":
+		keep, ok := filterOps[fn]
+		if !ok {
+			return nil, unknownOpError("filter", filterOps)
+		}
+		kept := make([]float64, 0, len(values))
+		for _, v := range values {
+			if keep(v) {
+				kept = append(kept, v)
+			}
+		}
+		result = kept
+	case "reduce":
+		fold, ok := reduceOps[fn]
+		if !ok {
+			return nil, unknownOpError("reduce", reduceOps)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("parameter 'values' must not be empty for reduce")
+		}
+		acc := values[0]
+		for _, v := range values[1:] {
+			acc = fold(acc, v)
+		}
+		if math.IsInf(acc, 0) {
+			return nil, fmt.Errorf("result of %s overflows", fn)
+		}
+		result = acc
+	default:
+		return nil, fmt.Errorf("parameter 'op' must be 'map', 'filter' or 'reduce'")
+	}
+
+	return result, nil
+}
+
+// unknownOpError lists the names fn may take for op.
+func unknownOpError[T any](op string, ops map[string]T) error {
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("parameter 'fn' must be one of %s for %s", strings.Join(names, ", "), op)
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// requestChunkSize is how many request bytes go in one chunk. Base64
+	// grows them by a third, which leaves room for the envelope within
+	// readBufferSize.
+	requestChunkSize = 512
+
+	// maxRequestChunks bounds the size of a reassembled request.
+	maxRequestChunks = 64
+
+	// maxPendingUploads bounds how many requests may be reassembled at
+	// once, so half-sent uploads cannot exhaust memory.
+	maxPendingUploads = 256
+
+	// uploadTTL is how long an incomplete upload waits for its chunks.
+	uploadTTL = 10 * time.Second
+)
+
+// requestChunk is one datagram of a request too large for a single one.
+// Chunk holds a base64 slice of the request's JSON encoding.
+type requestChunk struct {
+	RequestID   string `json:"request_id"`
+	ChunkIndex  int    `json:"chunk_index"`
+	TotalChunks int    `json:"total_chunks"`
+	Chunk       string `json:"chunk"`
+}
+
+// splitRequest cuts an encoded request into chunk datagrams.
+func splitRequest(requestID string, data []byte) ([][]byte, error) {
+	total := (len(data) + requestChunkSize - 1) / requestChunkSize
+	if total > maxRequestChunks {
+		return nil, fmt.Errorf("request of %d bytes is over the %d byte limit", len(data), maxRequestChunks*requestChunkSize)
+	}
+
+	packets := make([][]byte, 0, total)
+	for i := 0; i < total; i++ {
+		piece := data[i*requestChunkSize : min((i+1)*requestChunkSize, len(data))]
+
+		packet, err := json.Marshal(requestChunk{
+			RequestID:   requestID,
+			ChunkIndex:  i,
+			TotalChunks: total,
+			Chunk:       base64.StdEncoding.EncodeToString(piece),
+		})
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
+// parseChunk reports whether data is a request chunk rather than a whole
+// request.
+func parseChunk(data []byte) (*requestChunk, bool) {
+	var chunk requestChunk
+	if err := json.Unmarshal(data, &chunk); err != nil || chunk.TotalChunks == 0 {
+		return nil, false
+	}
+
+	return &chunk, true
+}
+
+// uploadAssembler joins request chunks on the server. Uploads are keyed
+// by source address and RequestID so one client cannot add chunks to
+// another's request.
+type uploadAssembler struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+type upload struct {
+	parts    [][]byte
+	received int
+	started  time.Time
+
+	// digest is a running SHA-256 of the request. Chunks may arrive in
+	// any order, so it is fed each one once all before it are in;
+	// hashed counts the chunks fed so far.
+	digest hash.Hash
+	hashed int
+}
+
+func newUploadAssembler() *uploadAssembler {
+	return &uploadAssembler{now: time.Now, uploads: make(map[string]*upload)}
+}
+
+// add records a chunk and returns the whole request once every chunk has
+// arrived, with the hex SHA-256 digest of it. Repeated chunks, e.g. from
+// a client retry, are ignored.
+func (a *uploadAssembler) add(addr net.Addr, chunk *requestChunk) ([]byte, string, bool, error) {
+	if chunk.TotalChunks < 0 || chunk.TotalChunks > maxRequestChunks {
+		return nil, "", false, fmt.Errorf("total_chunks must be between 1 and %d", maxRequestChunks)
+	}
+	if chunk.ChunkIndex < 0 || chunk.ChunkIndex >= chunk.TotalChunks {
+		return nil, "", false, fmt.Errorf("chunk_index %d is out of range", chunk.ChunkIndex)
+	}
+
+	piece, err := base64.StdEncoding.DecodeString(chunk.Chunk)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("chunk is not valid base64: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	for key, u := range a.uploads {
+		if now.Sub(u.started) > uploadTTL {
+			delete(a.uploads, key)
+		}
+	}
+
+	key := addrString(addr) + "\x00" + chunk.RequestID
+	u, ok := a.uploads[key]
+	if !ok {
+		if len(a.uploads) >= maxPendingUploads {
+			return nil, "", false, fmt.Errorf("too many uploads in progress")
+		}
+		u = &upload{parts: make([][]byte, chunk.TotalChunks), started: now, digest: sha256.New()}
+		a.uploads[key] = u
+	}
+	if len(u.parts) != chunk.TotalChunks {
+		return nil, "", false, fmt.Errorf("total_chunks changed from %d to %d", len(u.parts), chunk.TotalChunks)
+	}
+
+	if u.parts[chunk.ChunkIndex] == nil {
+		u.parts[chunk.ChunkIndex] = piece
+		u.received++
+	}
+	for u.hashed < len(u.parts) && u.parts[u.hashed] != nil {
+		u.digest.Write(u.parts[u.hashed])
+		u.hashed++
+	}
+	if u.received < len(u.parts) {
+		return nil, "", false, nil
+	}
+
+	delete(a.uploads, key)
+
+	whole := make([]byte, 0, len(u.parts)*requestChunkSize)
+	for _, part := range u.parts {
+		whole = append(whole, part...)
+	}
+
+	return whole, hex.EncodeToString(u.digest.Sum(nil)), true, nil
+}
+
+// digestHex is the hex SHA-256 of data, as reported in UploadDigest.
+func digestHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestChunkedRoundTrip(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	values := make([]int, 400)
+	sorted := make([]int, 400)
+	for i := range values {
+		values[i] = 1000 - i
+		sorted[i] = 601 + i
+	}
+	long := strings.Repeat("x", 2000)
+
+	tests := []struct {
+		name   string
+		method string
+		params params
+		want   interface{}
+	}{
+		{"sort", "sort", params{"values": values}, sorted},
+		{"echo", "echo", params{"s": long}, params{"s": long}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Both the request and the response are larger than one
+			// 1024-byte datagram, and the client uses its default buffer.
+			if size := len(mustMarshal(t, tt.params)); size <= readBufferSize {
+				t.Fatalf("params are only %d bytes", size)
+			}
+
+			resp := ts.call(t, tt.method, tt.params)
+			if resp.Status != "OK" {
+				t.Fatalf("status %s (%s)", resp.Status, resp.Error)
+			}
+			if !jsonEqual(t, resp.Result, tt.want) {
+				t.Errorf("result does not match")
+			}
+			if resp.UploadDigest == "" {
+				t.Error("a chunked request got no upload_digest")
+			}
+		})
+	}
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	_, err := ts.client(t).Call("echo", params{"s": strings.Repeat("x", maxRequestChunks*requestChunkSize)})
+	if err == nil || !strings.Contains(err.Error(), "byte limit") {
+		t.Errorf("got %v, want the request to be refused", err)
+	}
+}
+
+func TestUploadAssembler(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 120))
+	packets, err := splitRequest("req", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("split into %d chunks, want 3", len(packets))
+	}
+
+	chunks := make([]*requestChunk, len(packets))
+	for i, packet := range packets {
+		chunk, ok := parseChunk(packet)
+		if !ok {
+			t.Fatalf("packet %d is not a chunk", i)
+		}
+		chunks[i] = chunk
+	}
+
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+	other := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40001}
+
+	t.Run("out of order with a repeat", func(t *testing.T) {
+		a := newUploadAssembler()
+
+		for _, i := range []int{2, 0, 2} {
+			if _, _, done, err := a.add(addr, chunks[i]); done || err != nil {
+				t.Fatalf("chunk %d: done %v, err %v", i, done, err)
+			}
+		}
+
+		// A chunk from another source does not complete the upload.
+		if _, _, done, _ := a.add(other, chunks[1]); done {
+			t.Fatal("another source completed the upload")
+		}
+
+		whole, digest, done, err := a.add(addr, chunks[1])
+		if !done || err != nil {
+			t.Fatalf("last chunk: done %v, err %v", done, err)
+		}
+		if string(whole) != string(data) {
+			t.Error("reassembled request differs")
+		}
+		if digest != digestHex(data) {
+			t.Errorf("digest %s, want %s", digest, digestHex(data))
+		}
+	})
+
+	tests := []struct {
+		name  string
+		chunk requestChunk
+		want  string
+	}{
+		{"too many chunks", requestChunk{RequestID: "r", TotalChunks: maxRequestChunks + 1}, "total_chunks"},
+		{"index out of range", requestChunk{RequestID: "r", ChunkIndex: 3, TotalChunks: 3}, "out of range"},
+		{"bad base64", requestChunk{RequestID: "r", TotalChunks: 2, Chunk: "%%"}, "base64"},
+		{"total changed", requestChunk{RequestID: "req", TotalChunks: 2, Chunk: chunks[0].Chunk}, "changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newUploadAssembler()
+			a.add(addr, chunks[0])
+
+			_, _, _, err := a.add(addr, &tt.chunk)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("too many uploads", func(t *testing.T) {
+		a := newUploadAssembler()
+		piece := base64.StdEncoding.EncodeToString([]byte("x"))
+
+		for i := 0; i < maxPendingUploads; i++ {
+			chunk := &requestChunk{RequestID: fmt.Sprintf("upload-%d", i), TotalChunks: 2, Chunk: piece}
+			if _, _, _, err := a.add(addr, chunk); err != nil {
+				t.Fatalf("upload %d: %v", i, err)
+			}
+		}
+
+		_, _, _, err := a.add(addr, &requestChunk{RequestID: "one more", TotalChunks: 2, Chunk: piece})
+		if err == nil || !strings.Contains(err.Error(), "too many uploads") {
+			t.Errorf("got %v, want the upload refused", err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	smallNumberWords = []string{
+		"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine",
+		"ten", "eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen",
+		"seventeen", "eighteen", "nineteen",
+	}
+	tensWords = []string{
+		"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety",
+	}
+	scaleWords = []string{"", "thousand", "million", "billion", "trillion"}
+)
+
+// maxWordsValue is the largest magnitude number_to_words accepts; beyond
+// it JSON numbers stop being exact integers anyway.
+const maxWordsValue = 999_999_999_999_999
+
+// numberToWords spells out an integer in English, e.g. 1234 becomes
+// "one thousand two hundred thirty-four".
+func (s *Service) numberToWords(ctx *CallContext, params map[string]interface{}) (interface{}, error) {
+	value, err := getInt(params, "value")
+	if err != nil {
+		return nil, err
+	}
+	if value > maxWordsValue || value < -maxWordsValue {
+		return nil, fmt.Errorf("parameter 'value' must be between %d and %d", -maxWordsValue, maxWordsValue)
+	}
+
+	if value == 0 {
+		return smallNumberWords[0], nil
+	}
+
+	words := make([]string, 0)
+	if value < 0 {
+		words = append(words, "minus")
+		value = -value
+	}
+
+	// Split into groups of three digits, most significant first.
+	groups := make([]int64, 0, len(scaleWords))
+	for ; value > 0; value /= 1000 {
+		groups = append(groups, value%1000)
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		if groups[i] == 0 {
+			continue
+		}
+		words = append(words, hundredsToWords(groups[i])...)
+		if scaleWords[i] != "" {
+			words = append(words, scaleWords[i])
+		}
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// hundredsToWords spells out 1 to 999.
+func hundredsToWords(n int64) []string {
+	words := make([]string, 0, 3)
+
+	if n >= 100 {
+		words = append(words, smallNumberWords[n/100], "hundred")
+		n %= 100
+	}
+
+	switch {
+	case n == 0:
+	case n < 20:
+		words = append(words, smallNumberWords[n])
+	case n%10 == 0:
+		words = append(words, tensWords[n/10])
+	default:
+		words = append(words, tensWords[n/10]+"-"+smallNumberWords[n%10])
+	}
+
+	return words
+}
@@ -1,14 +1,123 @@
 package config
 
 import (
+	"log/slog"
 	"net"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
 
+// Config is loaded from the environment. Tag fields holding credentials
+// with `secret:"true"` so the config method redacts them.
 type Config struct {
 	Addr string `env:"ADDR"`
 	Port int    `env:"PORT"`
+
+	// SocketPath additionally serves requests on a Unix datagram socket.
+	SocketPath string `env:"SOCKET_PATH"`
+
+	// MaxResponseSize caps the output of methods that can build large
+	// results, in bytes. Zero means the built-in default.
+	MaxResponseSize int `env:"MAX_RESPONSE_SIZE"`
+
+	// LenientNumbers lets arithmetic methods accept numeric strings.
+	LenientNumbers bool `env:"LENIENT_NUMBERS"`
+
+	// MaxFibonacciN caps n for the fibonacci method. Zero means the
+	// built-in default.
+	MaxFibonacciN int `env:"MAX_FIBONACCI_N"`
+
+	// RequestTimeout bounds how long a method may run. MethodTimeouts
+	// overrides it per method, e.g. "eval:5s,add:100ms". Zero disables it.
+	RequestTimeout time.Duration            `env:"REQUEST_TIMEOUT"`
+	MethodTimeouts map[string]time.Duration `env:"METHOD_TIMEOUTS"`
+
+	// ShutdownTimeout bounds how long shutdown waits for in-flight
+	// requests before closing the sockets anyway. Zero waits for them all.
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT"`
+
+	// IdleTimeout stops the server once no packet has arrived for this
+	// long, so test servers do not outlive their run. Zero disables it.
+	IdleTimeout time.Duration `env:"IDLE_TIMEOUT"`
+
+	// MaxRequestsPerSecond caps total throughput across all clients.
+	// Requests over the cap are answered OVERLOADED. Zero disables it.
+	MaxRequestsPerSecond float64 `env:"MAX_REQUESTS_PER_SECOND"`
+
+	// MetricsAddr serves HTTP metrics, e.g. ":9100". The RPC server still
+	// starts if it cannot be bound.
+	MetricsAddr string `env:"METRICS_ADDR"`
+
+	// AdminToken authorizes admin methods such as drain. Admin methods
+	// are disabled when it is empty.
+	AdminToken string `env:"ADMIN_TOKEN" secret:"true"`
+
+	// ChallengeMethods must prove their source address with a nonce
+	// round trip before they run, since UDP sources can be spoofed.
+	ChallengeMethods []string `env:"CHALLENGE_METHODS"`
+
+	// DedupKey is what duplicate detection keys on: "request_id" (the
+	// default) or "payload", which also requires the method and params to
+	// match before a request counts as a duplicate.
+	DedupKey string `env:"DEDUP_KEY"`
+
+	// CompressThreshold gzips responses larger than this many bytes.
+	// Zero disables compression.
+	CompressThreshold int `env:"COMPRESS_THRESHOLD"`
+
+	// ResponseEnvelope selects the response shape: "default" or
+	// "ok_data". Only the default is understood by RPCClient.
+	ResponseEnvelope string `env:"RESPONSE_ENVELOPE"`
+
+	// LogLevel is the initial log level: debug, info (the default), warn
+	// or error. The set_log_level admin method changes it at run time.
+	LogLevel slog.Level `env:"LOG_LEVEL"`
+
+	// LogSampleRate logs one in every N successful requests; failures are
+	// always logged. LogSampleRates overrides it per method, e.g.
+	// "add:100,get_time:1000". Zero or one logs every request.
+	LogSampleRate  int            `env:"LOG_SAMPLE_RATE"`
+	LogSampleRates map[string]int `env:"LOG_SAMPLE_RATES"`
+
+	// TraceEndpoint exports a span per request to an OpenTelemetry
+	// collector, e.g. "http://localhost:4318/v1/traces". Tracing is off
+	// when it is empty.
+	TraceEndpoint string `env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+
+	// AllowCIDRs and DenyCIDRs filter UDP sources, e.g. "10.0.0.0/8".
+	// A deny match wins over an allow match; sources in neither list are
+	// allowed unless IPDefaultPolicy is "deny". Refused requests get
+	// FORBIDDEN; anything else from a refused source is dropped.
+	AllowCIDRs      []string `env:"ALLOW_CIDRS"`
+	DenyCIDRs       []string `env:"DENY_CIDRS"`
+	IPDefaultPolicy string   `env:"IP_DEFAULT_POLICY"`
+
+	// ClientTimeout, ClientMaxRetries and ClientBackoff are the client
+	// settings the capabilities method recommends. A zero timeout or
+	// backoff and an unset ClientMaxRetries mean the built-in defaults of
+	// 2s, 2 retries and 500ms. ClientMaxRetries is a pointer so that an
+	// explicit 0 can advertise no retries.
+	ClientTimeout    time.Duration `env:"CLIENT_TIMEOUT"`
+	ClientMaxRetries *int          `env:"CLIENT_MAX_RETRIES"`
+	ClientBackoff    time.Duration `env:"CLIENT_BACKOFF"`
+
+	// PluginDir is a directory of Go plugins (.so files) loaded at
+	// startup to add methods. Plugins are only supported on Linux,
+	// FreeBSD and macOS, and must be built with the server's Go version.
+	PluginDir string `env:"PLUGIN_DIR"`
+
+	// FaultDelayRate is the fraction of requests held for three seconds
+	// before running, to exercise client timeouts. FaultTransientRate is
+	// the fraction answered TRANSIENT without running, to exercise client
+	// retries. Both are between 0 and 1.
+	FaultDelayRate     float64 `env:"FAULT_DELAY_RATE" envDefault:"0.2"`
+	FaultTransientRate float64 `env:"FAULT_TRANSIENT_RATE"`
+
+	// AuditLogPath enables the JSON lines audit log when set.
+	AuditLogPath string `env:"AUDIT_LOG_PATH"`
+	// AuditRedactMethods lists methods whose params are left out of the audit log.
+	AuditRedactMethods []string `env:"AUDIT_REDACT_METHODS"`
 }
 
 func New() (*Config, error) {